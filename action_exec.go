@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"go.uber.org/zap"
+)
+
+// splitCommand splits a command line into arguments, honoring single and
+// double quotes and backslash escapes.
+func splitCommand(s string) ([]string, error) {
+	args := make([]string, 0)
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else if c == '\\' && quote == '"' && i+1 < len(runes) {
+				i++
+				cur.WriteRune(runes[i])
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == '\\':
+			if i+1 < len(runes) {
+				i++
+				cur.WriteRune(runes[i])
+				inArg = true
+			}
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.Newf("unterminated quote in command: %s", s)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return args, nil
+}
+
+var placeholders = []string{"{}", "{/}", "{//}", "{.}", "{/.}"}
+
+func hasPlaceholder(arg string) bool {
+	for _, p := range placeholders {
+		if strings.Contains(arg, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandPlaceholders replaces fd style placeholders in arg:
+// {} path, {/} basename, {//} parent directory, {.} path without extension
+// and {/.} basename without extension.
+func expandPlaceholders(arg string, path string) string {
+	base := filepath.Base(path)
+	return strings.NewReplacer(
+		"{//}", filepath.Dir(path),
+		"{/.}", strings.TrimSuffix(base, filepath.Ext(base)),
+		"{/}", base,
+		"{.}", strings.TrimSuffix(path, filepath.Ext(path)),
+		"{}", path,
+	).Replace(arg)
+}
+
+// commandTemplate is a parsed exec command, paths are appended as the last
+// argument if no argument contains a placeholder.
+type commandTemplate struct {
+	args []string
+}
+
+func newCommandTemplate(s string) (commandTemplate, error) {
+	args, err := splitCommand(s)
+	if err != nil {
+		return commandTemplate{}, err
+	}
+	for _, arg := range args[1:] {
+		if hasPlaceholder(arg) {
+			return commandTemplate{args: args}, nil
+		}
+	}
+	return commandTemplate{args: append(args, "{}")}, nil
+}
+
+// outputLock keeps the output of concurrent commands from interleaving.
+var outputLock sync.Mutex
+
+func runCommand(args []string) error {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+
+	outputLock.Lock()
+	_, _ = os.Stdout.Write(stdout.Bytes())
+	_, _ = os.Stderr.Write(stderr.Bytes())
+	outputLock.Unlock()
+	return err
+}
+
+// exitCode returns the exit code carried by err, or -1 if the command did
+// not run to completion.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// ExecAction runs a command once per path.
+type ExecAction struct {
+	command commandTemplate
+}
+
+var _ Action = &ExecAction{}
+
+func (a ExecAction) Execute(path string) error {
+	args := make([]string, len(a.command.args))
+	for i, arg := range a.command.args {
+		args[i] = expandPlaceholders(arg, path)
+	}
+	return runCommand(args)
+}
+
+// maxBatchArgs bounds the size of a single batched command line.
+const maxBatchArgs = 128 * 1024
+
+// ExecBatchAction collects every path and runs the command once at the end,
+// an argument with a placeholder is repeated for each path. Very long path
+// lists are split over several invocations.
+type ExecBatchAction struct {
+	command commandTemplate
+
+	mu    sync.Mutex
+	paths []string
+}
+
+var _ batchAction = &ExecBatchAction{}
+
+func (a *ExecBatchAction) Execute(path string) error {
+	a.mu.Lock()
+	a.paths = append(a.paths, path)
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *ExecBatchAction) Flush(fail func(path string, err error)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for len(a.paths) > 0 {
+		n, size := 0, 0
+		for n < len(a.paths) && (n == 0 || size+len(a.paths[n]) < maxBatchArgs) {
+			size += len(a.paths[n]) + 1
+			n++
+		}
+		batch := a.paths[:n]
+		a.paths = a.paths[n:]
+
+		args := make([]string, 0, len(a.command.args)+len(batch))
+		for _, arg := range a.command.args {
+			if !hasPlaceholder(arg) {
+				args = append(args, arg)
+				continue
+			}
+			for _, path := range batch {
+				args = append(args, expandPlaceholders(arg, path))
+			}
+		}
+
+		zap.L().Info("Executing batch", zap.String("command", args[0]), zap.Int("paths", len(batch)))
+		if err := runCommand(args); err != nil {
+			for _, path := range batch {
+				fail(path, err)
+			}
+		}
+	}
+}
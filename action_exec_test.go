@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ExecActionTestSuite struct {
+	suite.Suite
+}
+
+func TestExecAction(t *testing.T) {
+	suite.Run(t, new(ExecActionTestSuite))
+}
+
+func (s *ExecActionTestSuite) TestSplitCommand() {
+	args, err := splitCommand(`convert {} -resize "50%" '{/.} small.jpg' a\ b`)
+	s.Require().NoError(err)
+	s.Equal([]string{"convert", "{}", "-resize", "50%", "{/.} small.jpg", "a b"}, args)
+
+	args, err = splitCommand(`echo "" "a \"b\""`)
+	s.Require().NoError(err)
+	s.Equal([]string{"echo", "", `a "b"`}, args)
+
+	_, err = splitCommand(`echo "abc`)
+	s.Error(err)
+	_, err = splitCommand("   ")
+	s.Error(err)
+}
+
+func (s *ExecActionTestSuite) TestExpandPlaceholders() {
+	path := "/data/photos/img.tar.gz"
+	s.Equal(path, expandPlaceholders("{}", path))
+	s.Equal("img.tar.gz", expandPlaceholders("{/}", path))
+	s.Equal("/data/photos", expandPlaceholders("{//}", path))
+	s.Equal("/data/photos/img.tar", expandPlaceholders("{.}", path))
+	s.Equal("img.tar", expandPlaceholders("{/.}", path))
+	s.Equal("/out/img.tar.bak", expandPlaceholders("/out/{/.}.bak", path))
+}
+
+func (s *ExecActionTestSuite) TestCommandTemplate() {
+	c, err := newCommandTemplate("ls -l")
+	s.Require().NoError(err)
+	s.Equal([]string{"ls", "-l", "{}"}, c.args)
+
+	c, err = newCommandTemplate("mv {} {.}.bak")
+	s.Require().NoError(err)
+	s.Equal([]string{"mv", "{}", "{.}.bak"}, c.args)
+}
+
+// failingRunner runs a command exiting with 3 on n paths.
+func (s *ExecActionTestSuite) failingRunner(n int) *actionRunner {
+	c, err := newCommandTemplate(`sh -c 'exit 3'`)
+	s.Require().NoError(err)
+	r := newActionRunner(ExecAction{command: c}, 4)
+	for i := 0; i < n; i++ {
+		r.Submit(fmt.Sprintf("%03d.txt", i), false)
+	}
+	return r
+}
+
+func (s *ExecActionTestSuite) TestExitCode() {
+	r := s.failingRunner(1)
+	s.ErrorContains(r.Wait(), "1 of 1 actions failed")
+	var b bytes.Buffer
+	r.Summary(&b)
+	s.Equal("1 of 1 actions failed:\n  [exit 3] 000.txt\n", b.String())
+}
+
+func (s *ExecActionTestSuite) TestTruncatedSummary() {
+	r := s.failingRunner(maxReportedFailures + 5)
+	s.Error(r.Wait())
+	var b bytes.Buffer
+	r.Summary(&b)
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	s.Len(lines, maxReportedFailures+2)
+	s.Equal(fmt.Sprintf("%d of %d actions failed:", maxReportedFailures+5, maxReportedFailures+5), lines[0])
+	s.Equal("  ... and 5 more", lines[len(lines)-1])
+}
+
+func (s *ExecActionTestSuite) TestBatchSplit() {
+	// every invocation logs how many paths it got
+	log := filepath.Join(s.T().TempDir(), "log")
+	c, err := newCommandTemplate(`sh -c 'echo $# >> ` + log + `' sh {}`)
+	s.Require().NoError(err)
+	a := &ExecBatchAction{command: c}
+	const paths = 300
+	long := strings.Repeat("x", 1000)
+	for i := 0; i < paths; i++ {
+		s.Require().NoError(a.Execute(fmt.Sprintf("%s%03d", long, i)))
+	}
+	a.Flush(func(path string, err error) { s.Fail(path, err) })
+
+	b, err := os.ReadFile(log)
+	s.Require().NoError(err)
+	counts := strings.Fields(string(b))
+	s.Greater(len(counts), 1)
+	total := 0
+	for _, count := range counts {
+		n, err := strconv.Atoi(count)
+		s.Require().NoError(err)
+		s.LessOrEqual(n*(len(long)+4), maxBatchArgs)
+		total += n
+	}
+	s.Equal(paths, total)
+	s.Empty(a.paths)
+}
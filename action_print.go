@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+type outputFormat int
+
+const (
+	formatPlain outputFormat = iota
+	formatJSON
+	formatJSONLines
+	formatCSV
+)
+
+func newOutputFormat(s string) (outputFormat, error) {
+	switch s {
+	case "", "plain":
+		return formatPlain, nil
+	case "json":
+		return formatJSON, nil
+	case "jsonl":
+		return formatJSONLines, nil
+	case "csv":
+		return formatCSV, nil
+	}
+	return 0, errors.Newf("unknown output format: %s", s)
+}
+
+var printColumns = []string{"size", "mode", "mtime", "inode", "xxhash"}
+
+func newPrintColumns(columns []string) ([]string, error) {
+	result := make([]string, 0, len(columns))
+	for _, c := range columns {
+		for _, name := range strings.Split(c, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			valid := false
+			for _, known := range printColumns {
+				valid = valid || known == name
+			}
+			if !valid {
+				return nil, errors.Newf("unknown column: %s, available: %s",
+					name, strings.Join(printColumns, ", "))
+			}
+			result = append(result, name)
+		}
+	}
+	return result, nil
+}
+
+// columnValue returns a metadata column of path, nil if it does not apply.
+func columnValue(column string, path string, info os.FileInfo) (any, error) {
+	switch column {
+	case "size":
+		return info.Size(), nil
+	case "mode":
+		return info.Mode().String(), nil
+	case "mtime":
+		return info.ModTime().Format(time.RFC3339), nil
+	case "inode":
+		st, ok := getSysStat(info)
+		if !ok {
+			return nil, nil
+		}
+		return st.Ino, nil
+	case "xxhash":
+		if !info.Mode().IsRegular() {
+			return nil, nil
+		}
+		h, err := xxHashFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return fmt.Sprintf("0x%x", h), nil
+	}
+	return nil, errors.Newf("unknown column: %s", column)
+}
+
+func columnText(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// marshalRecord encodes path and its columns as a JSON object, keeping the
+// order of the columns. match is added when --contains found one.
+func marshalRecord(path string, columns []string, values []any, match *contentMatch) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(`{"path":`)
+	b, err := json.Marshal(path)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(b)
+	for i, column := range columns {
+		b, err = json.Marshal(values[i])
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(`,"` + column + `":`)
+		buf.Write(b)
+	}
+	if match != nil {
+		b, err = json.Marshal(match)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(`,"match":`)
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// PrintAction writes every path, with optional metadata columns, to its
+// writer. Execute is safe for concurrent use.
+type PrintAction struct {
+	format  outputFormat
+	columns []string
+	print0  bool
+
+	// contents is set to report the first --contains match of each path
+	contents *contentFilter
+
+	mu      sync.Mutex
+	w       *bufio.Writer
+	csv     *csv.Writer
+	started bool
+}
+
+var (
+	_ batchAction  = &PrintAction{}
+	_ outputAction = &PrintAction{}
+)
+
+func (a *PrintAction) WritesOutput() {}
+
+// ReportsMatches reports whether the output has room for content matches.
+func (a *PrintAction) ReportsMatches() bool {
+	return a.format == formatJSON || a.format == formatJSONLines
+}
+
+func newPrintAction(w io.Writer, format outputFormat, columns []string, print0 bool) (*PrintAction, error) {
+	if print0 && format != formatPlain {
+		return nil, errors.New("--print0 only works with the plain format")
+	}
+	a := &PrintAction{
+		format:  format,
+		columns: columns,
+		print0:  print0,
+		w:       bufio.NewWriter(w),
+	}
+	if format == formatCSV {
+		a.csv = csv.NewWriter(a.w)
+	}
+	return a, nil
+}
+
+func (a *PrintAction) Execute(path string) error {
+	values := make([]any, len(a.columns))
+	if len(a.columns) > 0 {
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		for i, column := range a.columns {
+			values[i], err = columnValue(column, path, info)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch a.format {
+	case formatJSON, formatJSONLines:
+		var match *contentMatch
+		if m, ok := a.contents.TakeMatch(path); ok {
+			match = &m
+		}
+		b, err := marshalRecord(path, a.columns, values, match)
+		if err != nil {
+			return err
+		}
+		if a.format == formatJSON {
+			if a.started {
+				_, _ = a.w.WriteString(",\n  ")
+			} else {
+				_, _ = a.w.WriteString("[\n  ")
+			}
+		}
+		a.started = true
+		_, _ = a.w.Write(b)
+		if a.format == formatJSONLines {
+			return a.w.WriteByte('\n')
+		}
+		return nil
+
+	case formatCSV:
+		if !a.started {
+			a.started = true
+			if err := a.csv.Write(append([]string{"path"}, a.columns...)); err != nil {
+				return err
+			}
+		}
+		record := []string{path}
+		for _, v := range values {
+			record = append(record, columnText(v))
+		}
+		return a.csv.Write(record)
+
+	default:
+		_, _ = a.w.WriteString(path)
+		for _, v := range values {
+			_ = a.w.WriteByte('\t')
+			_, _ = a.w.WriteString(columnText(v))
+		}
+		if a.print0 {
+			return a.w.WriteByte(0)
+		}
+		return a.w.WriteByte('\n')
+	}
+}
+
+func (a *PrintAction) Flush(fail func(path string, err error)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch a.format {
+	case formatJSON:
+		if a.started {
+			_, _ = a.w.WriteString("\n]\n")
+		} else {
+			_, _ = a.w.WriteString("[]\n")
+		}
+	case formatCSV:
+		if !a.started {
+			_ = a.csv.Write(append([]string{"path"}, a.columns...))
+		}
+		a.csv.Flush()
+	default:
+	}
+	if err := a.w.Flush(); err != nil {
+		fail("<output>", err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PrintActionTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func TestPrintAction(t *testing.T) {
+	suite.Run(t, new(PrintActionTestSuite))
+}
+
+func (s *PrintActionTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.Require().NoError(os.WriteFile(filepath.Join(s.dir, "a.txt"), []byte("hello"), 0644))
+}
+
+func (s *PrintActionTestSuite) print(format outputFormat, columns []string, print0 bool) string {
+	var buf bytes.Buffer
+	a, err := newPrintAction(&buf, format, columns, print0)
+	s.Require().NoError(err)
+	s.Require().NoError(a.Execute(filepath.Join(s.dir, "a.txt")))
+	a.Flush(func(path string, err error) { s.Fail("flush failed", err) })
+	return buf.String()
+}
+
+func (s *PrintActionTestSuite) TestFormats() {
+	path := filepath.Join(s.dir, "a.txt")
+
+	s.Equal(path+"\n", s.print(formatPlain, nil, false))
+	s.Equal(path+"\x00", s.print(formatPlain, nil, true))
+	s.Equal(path+"\t5\n", s.print(formatPlain, []string{"size"}, false))
+	s.Equal(`{"path":"`+path+`","size":5}`+"\n", s.print(formatJSONLines, []string{"size"}, false))
+	s.Equal("[\n  {\"path\":\""+path+"\"}\n]\n", s.print(formatJSON, nil, false))
+	s.Equal("path,size\n"+path+",5\n", s.print(formatCSV, []string{"size"}, false))
+}
+
+func (s *PrintActionTestSuite) TestOrder() {
+	var paths []string
+	for i := range 100 {
+		paths = append(paths, filepath.Join(s.dir, fmt.Sprintf("%03d", i)))
+	}
+	var buf bytes.Buffer
+	a, err := newPrintAction(&buf, formatPlain, nil, false)
+	s.Require().NoError(err)
+	r := newActionRunner(a, 8)
+	for _, p := range paths {
+		r.Submit(p, false)
+	}
+	s.Require().NoError(r.Wait())
+	s.Equal(strings.Join(paths, "\n")+"\n", buf.String())
+}
+
+func (s *PrintActionTestSuite) TestColumns() {
+	columns, err := newPrintColumns([]string{"size,mtime", "xxhash"})
+	s.Require().NoError(err)
+	s.Equal([]string{"size", "mtime", "xxhash"}, columns)
+
+	_, err = newPrintColumns([]string{"owner"})
+	s.Error(err)
+
+	_, err = newPrintAction(&bytes.Buffer{}, formatJSON, nil, true)
+	s.Error(err)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"go.uber.org/zap"
+)
+
+// treeAction is implemented by actions that consume a directory together
+// with everything below it, such as deleting or moving it. The walk must not
+// descend into a directory handed to such an action.
+type treeAction interface {
+	Action
+	ConsumesTree()
+}
+
+// batchAction is implemented by actions that have work left to do once
+// every path has been executed, such as running a batched command or
+// flushing buffered output.
+type batchAction interface {
+	Action
+	Flush(fail func(path string, err error))
+}
+
+// outputAction is implemented by actions that write every path they are
+// given, such as print and template. They run on the goroutine submitting
+// the paths instead of the workers, so the output keeps the order of the
+// walk, or of --sort, whatever the number of jobs.
+type outputAction interface {
+	Action
+	WritesOutput()
+}
+
+// retargetAction is implemented by actions that write to a destination,
+// Retarget returns a copy that writes into the subdirectory dir under the
+// name name instead. Empty arguments keep the defaults.
+type retargetAction interface {
+	Action
+	Retarget(dir string, name string) Action
+}
+
+// destinationAction is implemented by actions that write below a directory,
+// the walk does not descend into it so it never sees what the action wrote.
+type destinationAction interface {
+	Action
+	Destination() string
+}
+
+// maxReportedFailures bounds how many failures are kept for the summary.
+const maxReportedFailures = 100
+
+type actionFailure struct {
+	path string
+	err  error
+}
+
+// actionRunner executes an Action on paths as soon as they are found, using
+// a bounded number of workers. Submit blocks while every worker is busy, so
+// memory use does not grow with the number of matches.
+type actionRunner struct {
+	action Action
+	jobs   chan actionJob
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	total    int
+	failed   int
+	failures []actionFailure
+	// batches are the batch actions that have to be flushed on Wait
+	batches []batchAction
+}
+
+// actionJob is a path with the action to execute on it.
+type actionJob struct {
+	path   string
+	action Action
+}
+
+func newActionRunner(action Action, jobs int) *actionRunner {
+	if jobs < 1 {
+		jobs = 1
+	}
+	r := &actionRunner{
+		action: action,
+		jobs:   make(chan actionJob, jobs),
+	}
+	if b, ok := action.(batchAction); ok {
+		r.batches = append(r.batches, b)
+	}
+	r.wg.Add(jobs)
+	for i := 0; i < jobs; i++ {
+		go r.work()
+	}
+	return r
+}
+
+func (r *actionRunner) work() {
+	defer r.wg.Done()
+	for job := range r.jobs {
+		err := job.action.Execute(job.path)
+		if err != nil {
+			r.fail(job.path, err)
+		}
+	}
+}
+
+func (r *actionRunner) fail(path string, err error) {
+	zap.L().Error("Action execute failed", zap.String("path", path), zap.Error(err))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed++
+	if len(r.failures) < maxReportedFailures {
+		r.failures = append(r.failures, actionFailure{path: path, err: err})
+	}
+}
+
+// Submit queues path for execution. It reports whether the action takes
+// over the whole tree below a directory, in which case the caller must not
+// walk into it.
+func (r *actionRunner) Submit(path string, isDir bool) bool {
+	return r.SubmitWith(path, isDir, nil)
+}
+
+// SubmitWith is Submit with an action that replaces the default one for
+// this path, nil keeps the default.
+func (r *actionRunner) SubmitWith(path string, isDir bool, action Action) bool {
+	if action == nil {
+		action = r.action
+	}
+
+	r.mu.Lock()
+	r.total++
+	if b, ok := action.(batchAction); ok && !slices.Contains(r.batches, b) {
+		r.batches = append(r.batches, b)
+	}
+	r.mu.Unlock()
+
+	if _, ok := action.(outputAction); ok {
+		err := action.Execute(path)
+		if err != nil {
+			r.fail(path, err)
+		}
+		return false
+	}
+	r.jobs <- actionJob{path: path, action: action}
+	return r.ConsumesTree(action, isDir)
+}
+
+// ConsumesTree reports whether action, nil for the default one, takes over
+// the whole tree below path when it is a directory.
+func (r *actionRunner) ConsumesTree(action Action, isDir bool) bool {
+	if action == nil {
+		action = r.action
+	}
+	_, ok := action.(treeAction)
+	return ok && isDir
+}
+
+// Wait stops accepting paths and blocks until every queued action is done.
+// It returns an error if any action failed.
+func (r *actionRunner) Wait() error {
+	close(r.jobs)
+	r.wg.Wait()
+	for _, b := range r.batches {
+		b.Flush(r.fail)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failed == 0 {
+		return nil
+	}
+	return errors.Newf("%d of %d actions failed", r.failed, r.total)
+}
+
+// Summary writes every recorded failure with its exit code, if any.
+func (r *actionRunner) Summary(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failed == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "%d of %d actions failed:\n", r.failed, r.total)
+	for _, f := range r.failures {
+		if code := exitCode(f.err); code >= 0 {
+			_, _ = fmt.Fprintf(w, "  [exit %d] %s\n", code, f.path)
+		} else {
+			_, _ = fmt.Fprintf(w, "  [error] %s: %v\n", f.path, f.err)
+		}
+	}
+	if r.failed > len(r.failures) {
+		_, _ = fmt.Fprintf(w, "  ... and %d more\n", r.failed-len(r.failures))
+	}
+}
+
+// pathLocker serializes actions that write to the same destination path,
+// so that concurrent workers cannot both pass an existence check.
+type pathLocker struct {
+	mu    sync.Mutex
+	locks map[string]*pathLock
+}
+
+type pathLock struct {
+	sync.Mutex
+	refs int
+}
+
+var dstLocks = &pathLocker{locks: make(map[string]*pathLock)}
+
+func (l *pathLocker) Lock(path string) (unlock func()) {
+	l.mu.Lock()
+	lock, ok := l.locks[path]
+	if !ok {
+		lock = &pathLock{}
+		l.locks[path] = lock
+	}
+	lock.refs++
+	l.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, path)
+		}
+		l.mu.Unlock()
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ActionRunnerTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func TestActionRunner(t *testing.T) {
+	suite.Run(t, new(ActionRunnerTestSuite))
+}
+
+func (s *ActionRunnerTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.T().Setenv("XDG_DATA_HOME", filepath.Join(s.dir, "data"))
+}
+
+// blockingAction holds every path until release is closed.
+type blockingAction struct {
+	started chan string
+	release chan struct{}
+	done    atomic.Int32
+}
+
+func (a *blockingAction) Execute(path string) error {
+	a.started <- path
+	<-a.release
+	a.done.Add(1)
+	return nil
+}
+
+func (s *ActionRunnerTestSuite) TestDeleteNestedTree() {
+	root := filepath.Join(s.dir, "root")
+	for i := 0; i < 5; i++ {
+		for j := 0; j < 5; j++ {
+			dir := filepath.Join(root, fmt.Sprintf("d%d", i), fmt.Sprintf("e%d", j), "f")
+			s.Require().NoError(os.MkdirAll(dir, 0755))
+			for k := 0; k < 5; k++ {
+				s.Require().NoError(os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.txt", k)), nil, 0644))
+			}
+		}
+	}
+	matcher, err := compilePattern("*", false, false)
+	s.Require().NoError(err)
+	exclude, err := newExclude(nil, false, false, matchOnPath)
+	s.Require().NoError(err)
+	f := &finder{
+		matcher:  matcher,
+		exclude:  exclude,
+		maxDepth: -1,
+		minDepth: 1,
+		runner:   newActionRunner(DeleteAction{}, 8),
+	}
+
+	// the walk must not descend into directories a worker is deleting
+	s.Require().NoError(f.walk(root))
+	s.Require().NoError(f.runner.Wait())
+	s.Equal(5, f.runner.total)
+	entries, err := os.ReadDir(root)
+	s.Require().NoError(err)
+	s.Empty(entries)
+}
+
+func (s *ActionRunnerTestSuite) TestSubmitBlocks() {
+	action := &blockingAction{started: make(chan string), release: make(chan struct{})}
+	r := newActionRunner(action, 2)
+
+	// two workers busy and two paths queued
+	for i := 0; i < 4; i++ {
+		r.Submit(fmt.Sprintf("%d", i), false)
+	}
+	<-action.started
+	<-action.started
+
+	submitted := make(chan struct{})
+	go func() {
+		r.Submit("4", false)
+		close(submitted)
+	}()
+	select {
+	case <-submitted:
+		s.Fail("Submit returned while every worker was busy")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(action.release)
+	go func() {
+		for range action.started {
+		}
+	}()
+	<-submitted
+	s.Require().NoError(r.Wait())
+	close(action.started)
+	s.Equal(int32(5), action.done.Load())
+}
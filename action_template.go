@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// humanSize formats a byte count with binary units, e.g. "1.5 MiB".
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit && size > -unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit || n <= -unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+var templateFuncs = template.FuncMap{
+	"human": humanSize,
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"trimPrefix": func(prefix string, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix string, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old string, new string, s string) string { return strings.ReplaceAll(s, old, new) },
+	"octal": func(mode fs.FileMode) string {
+		return fmt.Sprintf("%04o", mode.Perm())
+	},
+}
+
+// unescapeTemplate expands \t, \n, \0 and \\ so tab separated templates can
+// be given in single quotes on the command line.
+func unescapeTemplate(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\0`, "\x00").Replace(s)
+}
+
+var (
+	userNames  sync.Map
+	groupNames sync.Map
+)
+
+func lookupUserName(uid uint32) string {
+	if name, ok := userNames.Load(uid); ok {
+		return name.(string)
+	}
+	id := strconv.FormatUint(uint64(uid), 10)
+	name := id
+	if u, err := user.LookupId(id); err == nil {
+		name = u.Username
+	}
+	userNames.Store(uid, name)
+	return name
+}
+
+func lookupGroupName(gid uint32) string {
+	if name, ok := groupNames.Load(gid); ok {
+		return name.(string)
+	}
+	id := strconv.FormatUint(uint64(gid), 10)
+	name := id
+	if g, err := user.LookupGroupId(id); err == nil {
+		name = g.Name
+	}
+	groupNames.Store(gid, name)
+	return name
+}
+
+// templateEntry is the value a --template is executed with.
+type templateEntry struct {
+	Path    string
+	Root    string
+	RelPath string
+	Dir     string
+	Name    string
+	Stem    string
+	Ext     string
+
+	Size    int64
+	Mode    fs.FileMode
+	ModTime time.Time
+	IsDir   bool
+	Uid     uint32
+	Gid     uint32
+}
+
+// Owner returns the user name of the owner, or the UID if it is unknown.
+func (e *templateEntry) Owner() string {
+	return lookupUserName(e.Uid)
+}
+
+// Group returns the group name, or the GID if it is unknown.
+func (e *templateEntry) Group() string {
+	return lookupGroupName(e.Gid)
+}
+
+// XXHash hashes the file contents, only when the template asks for it.
+func (e *templateEntry) XXHash() (string, error) {
+	if !e.Mode.IsRegular() {
+		return "", nil
+	}
+	h, err := xxHashFile(e.Path)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("0x%x", h), nil
+}
+
+// rootOf returns the longest root that contains path, or an empty string.
+func rootOf(roots []string, path string) string {
+	best := ""
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if len(root) > len(best) {
+			best = root
+		}
+	}
+	return best
+}
+
+func newTemplateEntry(roots []string, path string) (*templateEntry, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	root := rootOf(roots, path)
+	rel := path
+	if root != "" {
+		rel, _ = filepath.Rel(root, path)
+	}
+	name := filepath.Base(path)
+	ext := filepath.Ext(name)
+	e := &templateEntry{
+		Path:    path,
+		Root:    root,
+		RelPath: rel,
+		Dir:     filepath.Dir(path),
+		Name:    name,
+		Stem:    strings.TrimSuffix(name, ext),
+		Ext:     strings.TrimPrefix(ext, "."),
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+	}
+	if st, ok := getSysStat(info); ok {
+		e.Uid = st.Uid
+		e.Gid = st.Gid
+	}
+	return e, nil
+}
+
+// TemplateAction prints every path through a text/template. Execute is safe
+// for concurrent use.
+type TemplateAction struct {
+	tmpl       *template.Template
+	roots      []string
+	terminator byte
+
+	mu sync.Mutex
+	w  *bufio.Writer
+}
+
+var (
+	_ batchAction  = &TemplateAction{}
+	_ outputAction = &TemplateAction{}
+)
+
+func (a *TemplateAction) WritesOutput() {}
+
+// newTemplateAction parses text, roots are the walk roots or the SQL base
+// directory that RelPath is computed against.
+func newTemplateAction(w io.Writer, text string, roots []string, print0 bool) (*TemplateAction, error) {
+	tmpl, err := template.New("find").Funcs(templateFuncs).Parse(unescapeTemplate(text))
+	if err != nil {
+		return nil, err
+	}
+	a := &TemplateAction{
+		tmpl:       tmpl,
+		roots:      roots,
+		terminator: '\n',
+		w:          bufio.NewWriter(w),
+	}
+	if print0 {
+		a.terminator = 0
+	}
+	return a, nil
+}
+
+func (a *TemplateAction) Execute(path string) error {
+	e, err := newTemplateEntry(a.roots, path)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	err = a.tmpl.Execute(&buf, e)
+	if err != nil {
+		return err
+	}
+	buf.WriteByte(a.terminator)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.w.Write(buf.Bytes())
+	return err
+}
+
+func (a *TemplateAction) Flush(fail func(path string, err error)) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.w.Flush(); err != nil {
+		fail("<output>", err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ActionTemplateTestSuite struct {
+	suite.Suite
+	dir  string
+	path string
+}
+
+func TestActionTemplate(t *testing.T) {
+	suite.Run(t, new(ActionTemplateTestSuite))
+}
+
+func (s *ActionTemplateTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.path = filepath.Join(s.dir, "sub", "photo.JPG")
+	s.Require().NoError(os.MkdirAll(filepath.Dir(s.path), 0755))
+	s.Require().NoError(os.WriteFile(s.path, []byte("hello"), 0640))
+	s.Require().NoError(os.Chmod(s.path, 0640))
+	mtime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local)
+	s.Require().NoError(os.Chtimes(s.path, mtime, mtime))
+}
+
+func (s *ActionTemplateTestSuite) render(text string, print0 bool) string {
+	var buf bytes.Buffer
+	a, err := newTemplateAction(&buf, text, []string{s.dir}, print0)
+	s.Require().NoError(err)
+	s.Require().NoError(a.Execute(s.path))
+	a.Flush(func(path string, err error) { s.Fail("flush failed", err) })
+	return buf.String()
+}
+
+func (s *ActionTemplateTestSuite) TestEntry() {
+	s.Equal(s.path+"|"+s.dir+"|sub/photo.JPG|"+filepath.Join(s.dir, "sub")+"\n",
+		s.render("{{.Path}}|{{.Root}}|{{.RelPath}}|{{.Dir}}", false))
+	s.Equal("photo.JPG|photo|JPG|5|false\n", s.render("{{.Name}}|{{.Stem}}|{{.Ext}}|{{.Size}}|{{.IsDir}}", false))
+	s.Equal("2024-05-06 07:08:09\n", s.render(`{{.ModTime.Format "2006-01-02 15:04:05"}}`, false))
+	s.Equal(fmt.Sprintf("%d:%d\n", os.Getuid(), os.Getgid()), s.render("{{.Uid}}:{{.Gid}}", false))
+
+	h, err := xxHashFile(s.path)
+	s.Require().NoError(err)
+	s.Equal(fmt.Sprintf("0x%x\n", h), s.render("{{.XXHash}}", false))
+}
+
+func (s *ActionTemplateTestSuite) TestFuncs() {
+	s.Equal("5 B|2024-05-06|JPG|photo.jpg|oto|pho|ph0t0|0640\n", s.render(`{{human .Size}}|{{date "2006-01-02" .ModTime}}|`+
+		`{{upper .Ext}}|{{lower .Name}}|{{trimPrefix "ph" .Stem}}|{{trimSuffix "to" .Stem}}|`+
+		`{{replace "o" "0" .Stem}}|{{octal .Mode}}`, false))
+	s.Equal("1.5 KiB", humanSize(1536))
+	s.Equal("2.0 GiB", humanSize(2<<30))
+
+	// escapes work in single quotes, print0 ends entries with NUL
+	s.Equal("photo.JPG\t5\x00", s.render(`{{.Name}}\t{{.Size}}`, true))
+}
+
+func (s *ActionTemplateTestSuite) TestInvalid() {
+	_, err := newTemplateAction(&bytes.Buffer{}, "{{.Path", nil, false)
+	s.Error(err)
+	_, err = newTemplateAction(&bytes.Buffer{}, "{{unknown .Path}}", nil, false)
+	s.Error(err)
+
+	a, err := newTemplateAction(&bytes.Buffer{}, "{{.Missing}}", nil, false)
+	s.Require().NoError(err)
+	s.Error(a.Execute(s.path))
+	s.Error(a.Execute(filepath.Join(s.dir, "missing")))
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v3"
+	"go.uber.org/zap"
+)
+
+// catalogSchema is the layout of a catalog database. Paths are relative to
+// their root, so a catalog stays valid when a drive is mounted elsewhere.
+// A root on a known volume also records its path below the mount point.
+// Times are Unix nanoseconds, mode holds the permission bits only.
+const catalogSchema = `
+CREATE TABLE IF NOT EXISTS volumes (
+	id          INTEGER PRIMARY KEY,
+	uuid        TEXT    NOT NULL UNIQUE,
+	label       TEXT    NOT NULL,
+	mount_point TEXT,
+	seen_at     INTEGER
+);
+CREATE TABLE IF NOT EXISTS roots (
+	id          INTEGER PRIMARY KEY,
+	path        TEXT    NOT NULL UNIQUE,
+	generation  INTEGER NOT NULL DEFAULT 0,
+	indexed_at  INTEGER,
+	volume_id   INTEGER REFERENCES volumes (id),
+	volume_path TEXT
+);
+CREATE TABLE IF NOT EXISTS files (
+	id         INTEGER PRIMARY KEY,
+	root_id    INTEGER NOT NULL REFERENCES roots (id) ON DELETE CASCADE,
+	parent_id  INTEGER REFERENCES files (id) ON DELETE CASCADE,
+	path       TEXT    NOT NULL,
+	name       TEXT    NOT NULL,
+	ext        TEXT    NOT NULL,
+	type       TEXT    NOT NULL,
+	size       INTEGER NOT NULL,
+	mode       INTEGER NOT NULL,
+	uid        INTEGER,
+	gid        INTEGER,
+	mtime      INTEGER NOT NULL,
+	ctime      INTEGER,
+	inode      INTEGER,
+	dev        INTEGER,
+	xxhash     TEXT,
+	generation INTEGER NOT NULL,
+	UNIQUE (root_id, path)
+);
+CREATE INDEX IF NOT EXISTS files_parent ON files (parent_id);
+CREATE INDEX IF NOT EXISTS files_name ON files (name);
+CREATE INDEX IF NOT EXISTS files_ext ON files (ext);
+CREATE INDEX IF NOT EXISTS files_size ON files (size);
+CREATE INDEX IF NOT EXISTS files_xxhash ON files (xxhash);
+`
+
+// openCatalog opens or creates the catalog database at dsn.
+func openCatalog(dsn string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// one connection, so the pragmas hold for every statement
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec("PRAGMA foreign_keys = ON; PRAGMA journal_mode = WAL;" + catalogSchema)
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "create catalog schema")
+	}
+	err = migrateCatalog(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "migrate catalog schema")
+	}
+	return db, nil
+}
+
+// catalogColumns are columns added after the first version of the schema,
+// catalogs written before get them on open.
+var catalogColumns = []struct{ table, column, decl string }{
+	{"roots", "volume_id", "INTEGER REFERENCES volumes (id)"},
+	{"roots", "volume_path", "TEXT"},
+}
+
+func migrateCatalog(db *sql.DB) error {
+	for _, c := range catalogColumns {
+		var count int
+		err := db.QueryRow(`SELECT count(*) FROM pragma_table_info(?) WHERE name = ?`,
+			c.table, c.column).Scan(&count)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+		_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.column, c.decl))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileTypeName names the type of an entry like the type attribute of --where.
+func fileTypeName(mode fs.FileMode) string {
+	switch {
+	case mode.IsDir():
+		return "dir"
+	case mode&fs.ModeSymlink != 0:
+		return "symlink"
+	case mode&fs.ModeSocket != 0:
+		return "socket"
+	case mode&fs.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&fs.ModeCharDevice != 0:
+		return "char-device"
+	case mode&fs.ModeDevice != 0:
+		return "block-device"
+	}
+	return "file"
+}
+
+// indexStats counts what an index run did to the catalog.
+type indexStats struct {
+	Added     int
+	Updated   int
+	Unchanged int
+	Removed   int
+}
+
+// catalogEntry is a row of the files table.
+type catalogEntry struct {
+	id     int64
+	size   int64
+	mtime  int64
+	xxhash sql.NullString
+}
+
+// indexer writes one root into a catalog. Entries whose size and mtime did
+// not change since the last run keep their hash instead of being read again.
+type indexer struct {
+	db     *sql.DB
+	hash   bool
+	ignore ignoreOptions
+
+	// volumes records the volume of every root, label names new volumes,
+	// labelVolumes writes label files to volumes without a UUID
+	volumes      bool
+	label        string
+	labelVolumes bool
+
+	tx         *sql.Tx
+	lookup     *sql.Stmt
+	upsert     *sql.Stmt
+	rootID     int64
+	generation int64
+	dirs       map[string]int64
+	stats      indexStats
+}
+
+func newIndexer(db *sql.DB, hash bool, ignore ignoreOptions) *indexer {
+	return &indexer{db: db, hash: hash, ignore: ignore}
+}
+
+// Index walks root and brings its catalog up to date in one transaction.
+func (x *indexer) Index(root string) (indexStats, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return indexStats{}, err
+	}
+	x.stats = indexStats{}
+	x.dirs = map[string]int64{}
+
+	x.tx, err = x.db.Begin()
+	if err != nil {
+		return indexStats{}, err
+	}
+	defer func() { _ = x.tx.Rollback() }()
+
+	err = x.tx.QueryRow(`INSERT INTO roots (path, generation) VALUES (?, 1)
+		ON CONFLICT (path) DO UPDATE SET generation = generation + 1
+		RETURNING id, generation`, root).Scan(&x.rootID, &x.generation)
+	if err != nil {
+		return indexStats{}, err
+	}
+	if x.volumes {
+		err = x.recordVolume(root)
+		if err != nil {
+			zap.L().Warn("Volume of root unknown, indexing it without a volume",
+				zap.String("root", root), zap.Error(err))
+		}
+	}
+
+	x.lookup, err = x.tx.Prepare(`SELECT id, size, mtime, xxhash FROM files WHERE root_id = ? AND path = ?`)
+	if err != nil {
+		return indexStats{}, err
+	}
+	defer func() { _ = x.lookup.Close() }()
+	x.upsert, err = x.tx.Prepare(`INSERT INTO files (root_id, parent_id, path, name, ext, type, size,
+		mode, uid, gid, mtime, ctime, inode, dev, xxhash, generation)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (root_id, path) DO UPDATE SET parent_id = excluded.parent_id, type = excluded.type,
+		size = excluded.size, mode = excluded.mode, uid = excluded.uid, gid = excluded.gid,
+		mtime = excluded.mtime, ctime = excluded.ctime, inode = excluded.inode, dev = excluded.dev,
+		xxhash = excluded.xxhash, generation = excluded.generation
+		RETURNING id`)
+	if err != nil {
+		return indexStats{}, err
+	}
+	defer func() { _ = x.upsert.Close() }()
+
+	ignore := newIgnoreRules(afero.NewOsFs(), root, x.ignore)
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		if skip, err := ignore.Skip(path, d); skip || err != nil {
+			return err
+		}
+		return x.add(root, path, d)
+	})
+	if err != nil {
+		return indexStats{}, err
+	}
+
+	result, err := x.tx.Exec(`DELETE FROM files WHERE root_id = ? AND generation != ?`, x.rootID, x.generation)
+	if err != nil {
+		return indexStats{}, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return indexStats{}, err
+	}
+	x.stats.Removed = int(removed)
+
+	_, err = x.tx.Exec(`UPDATE roots SET indexed_at = ? WHERE id = ?`, time.Now().UnixNano(), x.rootID)
+	if err != nil {
+		return indexStats{}, err
+	}
+	return x.stats, x.tx.Commit()
+}
+
+// recordVolume identifies the volume root is on and links it to the root.
+func (x *indexer) recordVolume(root string) error {
+	v, err := identifyVolume(root, x.label, x.labelVolumes)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(v.MountPoint, root)
+	if err != nil {
+		return err
+	}
+	if rel == "." {
+		rel = ""
+	}
+
+	var volumeID int64
+	err = x.tx.QueryRow(`INSERT INTO volumes (uuid, label, mount_point, seen_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (uuid) DO UPDATE SET label = excluded.label, mount_point = excluded.mount_point,
+		seen_at = excluded.seen_at
+		RETURNING id`, v.UUID, v.Label, v.MountPoint, time.Now().UnixNano()).Scan(&volumeID)
+	if err != nil {
+		return err
+	}
+	_, err = x.tx.Exec(`UPDATE roots SET volume_id = ?, volume_path = ? WHERE id = ?`, volumeID, rel, x.rootID)
+	return err
+}
+
+func (x *indexer) add(root string, path string, d fs.DirEntry) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+
+	var old catalogEntry
+	err = x.lookup.QueryRow(x.rootID, rel).Scan(&old.id, &old.size, &old.mtime, &old.xxhash)
+	found := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	unchanged := found && old.size == info.Size() && old.mtime == info.ModTime().UnixNano()
+
+	var hash sql.NullString
+	if x.hash && info.Mode().IsRegular() {
+		if unchanged && old.xxhash.Valid {
+			hash = old.xxhash
+		} else {
+			h, err := xxHashFile(path)
+			if err != nil {
+				return err
+			}
+			hash = sql.NullString{String: fmt.Sprintf("0x%x", h), Valid: true}
+		}
+	}
+
+	var parentID sql.NullInt64
+	if id, ok := x.dirs[filepath.Dir(path)]; ok {
+		parentID = sql.NullInt64{Int64: id, Valid: true}
+	}
+	var uid, gid, ctime, inode, dev sql.NullInt64
+	if st, ok := getSysStat(info); ok {
+		uid = sql.NullInt64{Int64: int64(st.Uid), Valid: true}
+		gid = sql.NullInt64{Int64: int64(st.Gid), Valid: true}
+		ctime = sql.NullInt64{Int64: st.Ctime.UnixNano(), Valid: true}
+		inode = sql.NullInt64{Int64: int64(st.Ino), Valid: true}
+		dev = sql.NullInt64{Int64: int64(st.Dev), Valid: true}
+	}
+
+	name := d.Name()
+	var id int64
+	err = x.upsert.QueryRow(x.rootID, parentID, rel, name,
+		strings.TrimPrefix(filepath.Ext(name), "."), fileTypeName(info.Mode()), info.Size(),
+		unixPerm(info.Mode()), uid, gid, info.ModTime().UnixNano(), ctime, inode, dev, hash,
+		x.generation).Scan(&id)
+	if err != nil {
+		return errors.Wrapf(err, "path: %s", path)
+	}
+	if d.IsDir() {
+		x.dirs[path] = id
+	}
+
+	switch {
+	case !found:
+		x.stats.Added++
+	case unchanged:
+		x.stats.Unchanged++
+	default:
+		x.stats.Updated++
+	}
+	return nil
+}
+
+var cmdIndex = &cli.Command{
+	Name:  "index",
+	Usage: "Write a catalog of a directory tree into SQLite, for find --dsn --sql",
+	Arguments: []cli.Argument{
+		&cli.StringArgs{Name: "path", Config: trimSpaceConfig, Min: 1, Max: -1},
+	},
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "dsn",
+			Usage:    "catalog database, created if it does not exist",
+			Required: true,
+		},
+		&cli.BoolFlag{
+			Name:  "xxhash",
+			Usage: "hash the contents of regular files, unchanged files keep their hash",
+		},
+		&cli.StringFlag{
+			Name:  "label",
+			Usage: "name of the volume in the catalog, defaults to the file system label",
+		},
+		&cli.BoolFlag{
+			Name:  "label-volume",
+			Usage: "write a " + volumeLabelFile + " file to the mount point of volumes without a UUID",
+		},
+		&cli.BoolFlag{
+			Name:  "no-volume",
+			Usage: "do not record the volume of the roots",
+		},
+		respectIgnoreFlag(),
+	},
+	Action: func(ctx context.Context, command *cli.Command) error {
+		roots := command.StringArgs("path")
+		if len(roots) == 0 {
+			return errors.New("path is required")
+		}
+
+		db, err := openCatalog(command.String("dsn"))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = db.Close() }()
+
+		x := newIndexer(db, command.Bool("xxhash"), newRespectIgnoreOptions(command))
+		x.volumes = !command.Bool("no-volume")
+		x.label = command.String("label")
+		x.labelVolumes = command.Bool("label-volume")
+		for _, root := range roots {
+			stats, err := x.Index(root)
+			if err != nil {
+				return errors.Wrapf(err, "index %s", root)
+			}
+			zap.L().Info("Indexed", zap.String("root", root),
+				zap.Int("added", stats.Added), zap.Int("updated", stats.Updated),
+				zap.Int("unchanged", stats.Unchanged), zap.Int("removed", stats.Removed))
+		}
+		return nil
+	},
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type CatalogTestSuite struct {
+	suite.Suite
+}
+
+func TestCatalog(t *testing.T) {
+	suite.Run(t, new(CatalogTestSuite))
+}
+
+func (s *CatalogTestSuite) TestIncrementalIndex() {
+	root := s.T().TempDir()
+	s.Require().NoError(os.MkdirAll(filepath.Join(root, "a", "b"), 0755))
+	s.Require().NoError(os.WriteFile(filepath.Join(root, "a", "one.txt"), []byte("one"), 0644))
+	s.Require().NoError(os.WriteFile(filepath.Join(root, "a", "b", "two.log"), []byte("two"), 0600))
+
+	db, err := openCatalog(filepath.Join(s.T().TempDir(), "catalog.db"))
+	s.Require().NoError(err)
+	defer func() { _ = db.Close() }()
+	x := newIndexer(db, true, ignoreOptions{})
+
+	stats, err := x.Index(root)
+	s.Require().NoError(err)
+	s.Equal(indexStats{Added: 4}, stats)
+
+	var parent, name, ext, typ, hash string
+	var size, mode int64
+	err = db.QueryRow(`SELECT p.path, f.name, f.ext, f.type, f.size, f.mode, f.xxhash
+		FROM files f JOIN files p ON p.id = f.parent_id WHERE f.path = ?`,
+		filepath.Join("a", "b", "two.log")).Scan(&parent, &name, &ext, &typ, &size, &mode, &hash)
+	s.Require().NoError(err)
+	s.Equal(filepath.Join("a", "b"), parent)
+	s.Equal("two.log", name)
+	s.Equal("log", ext)
+	s.Equal("file", typ)
+	s.Equal(int64(3), size)
+	s.Equal(int64(0600), mode)
+	h, err := xxHashFile(filepath.Join(root, "a", "b", "two.log"))
+	s.Require().NoError(err)
+	s.Equal(fmt.Sprintf("0x%x", h), hash)
+
+	// change one file, remove one, add one
+	later := time.Now().Add(time.Hour)
+	s.Require().NoError(os.WriteFile(filepath.Join(root, "a", "one.txt"), []byte("changed"), 0644))
+	s.Require().NoError(os.Chtimes(filepath.Join(root, "a", "one.txt"), later, later))
+	s.Require().NoError(os.Remove(filepath.Join(root, "a", "b", "two.log")))
+	s.Require().NoError(os.WriteFile(filepath.Join(root, "three"), nil, 0644))
+	s.Require().NoError(os.Chtimes(filepath.Join(root, "a", "b"), later, later))
+
+	stats, err = x.Index(root)
+	s.Require().NoError(err)
+	s.Equal(indexStats{Added: 1, Updated: 2, Unchanged: 1, Removed: 1}, stats)
+
+	var count int
+	s.Require().NoError(db.QueryRow(`SELECT count(*) FROM files`).Scan(&count))
+	s.Equal(4, count)
+}
+
+func (s *CatalogTestSuite) TestUnidentifiedVolume() {
+	// a tmpfs has no file system UUID
+	root, err := os.MkdirTemp("/dev/shm", "gofd-index-")
+	if err != nil {
+		s.T().Skip("no tmpfs at /dev/shm")
+	}
+	defer func() { _ = os.RemoveAll(root) }()
+	s.Require().NoError(os.WriteFile(filepath.Join(root, "a.txt"), []byte("a"), 0644))
+
+	db, err := openCatalog(filepath.Join(s.T().TempDir(), "catalog.db"))
+	s.Require().NoError(err)
+	defer func() { _ = db.Close() }()
+	x := newIndexer(db, false, ignoreOptions{})
+	x.volumes = true
+
+	stats, err := x.Index(root)
+	s.Require().NoError(err)
+	s.Equal(indexStats{Added: 1}, stats)
+	var volumeID sql.NullInt64
+	s.Require().NoError(db.QueryRow(`SELECT volume_id FROM roots`).Scan(&volumeID))
+	s.False(volumeID.Valid)
+	s.NoFileExists(filepath.Join("/dev/shm", volumeLabelFile))
+}
+
+func (s *CatalogTestSuite) TestMigrate() {
+	dsn := filepath.Join(s.T().TempDir(), "catalog.db")
+	db, err := sql.Open("sqlite3", dsn)
+	s.Require().NoError(err)
+	_, err = db.Exec(`CREATE TABLE roots (id INTEGER PRIMARY KEY, path TEXT NOT NULL UNIQUE,
+		generation INTEGER NOT NULL DEFAULT 0, indexed_at INTEGER)`)
+	s.Require().NoError(err)
+	s.Require().NoError(db.Close())
+
+	db, err = openCatalog(dsn)
+	s.Require().NoError(err)
+	defer func() { _ = db.Close() }()
+	_, err = db.Exec(`UPDATE roots SET volume_id = NULL, volume_path = NULL`)
+	s.NoError(err)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/cockroachdb/pebble"
 	"github.com/jotfs/fastcdc-go"
 	"github.com/negrel/assert"
+	"github.com/spf13/afero"
 	"github.com/urfave/cli/v3"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/proto"
@@ -49,6 +50,7 @@ var cmdDeduplicateChunk = &cli.Command{
 			Aliases:  []string{"d"},
 			Required: true,
 		},
+		respectIgnoreFlag(),
 	},
 	Action: func(ctx context.Context, command *cli.Command) error {
 		rootDir := command.StringArg("path")
@@ -61,10 +63,14 @@ var cmdDeduplicateChunk = &cli.Command{
 		defer func() { _ = db.Close() }()
 
 		cd := NewChunkDeduplicator(db)
+		ignore := newIgnoreRules(afero.NewOsFs(), rootDir, newRespectIgnoreOptions(command))
 		err = filepath.WalkDir(rootDir, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
+			if skip, err := ignore.Skip(path, d); skip || err != nil {
+				return err
+			}
 			if d.IsDir() {
 				return nil
 			}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v3"
+	"go.uber.org/zap"
+)
+
+// conflictPolicy decides what copies and moves do when their destination
+// already exists.
+type conflictPolicy int
+
+const (
+	conflictFail conflictPolicy = iota
+	conflictSkip
+	conflictOverwrite
+	conflictOverwriteIfNewer
+	conflictOverwriteIfLarger
+	// conflictRename appends a number to the name, "name (1).ext"
+	conflictRename
+	// conflictRenameHash appends the hash of the contents to the name, so
+	// the same file is never kept twice
+	conflictRenameHash
+	// conflictKeepBoth puts the new entry in the conflictDir subdirectory
+	conflictKeepBoth
+)
+
+var conflictPolicyNames = []string{
+	conflictFail:              "fail",
+	conflictSkip:              "skip",
+	conflictOverwrite:         "overwrite",
+	conflictOverwriteIfNewer:  "overwrite-if-newer",
+	conflictOverwriteIfLarger: "overwrite-if-larger",
+	conflictRename:            "rename",
+	conflictRenameHash:        "rename-hash",
+	conflictKeepBoth:          "keep-both",
+}
+
+// conflictDir is where conflictKeepBoth puts the new entries, next to the
+// existing ones.
+const conflictDir = "conflicts"
+
+func newConflictPolicy(s string) (conflictPolicy, error) {
+	for p, name := range conflictPolicyNames {
+		if s == name {
+			return conflictPolicy(p), nil
+		}
+	}
+	return 0, errors.Newf("unknown conflict policy: %s", s)
+}
+
+func (p conflictPolicy) String() string {
+	return conflictPolicyNames[p]
+}
+
+func conflictFlag(value string) cli.Flag {
+	return &cli.StringFlag{
+		Name:  "on-conflict",
+		Usage: "when the destination exists: " + strings.Join(conflictPolicyNames, ", "),
+		Value: value,
+	}
+}
+
+// lexists reports whether path exists, without following symbolic links
+// where fs supports it.
+func lexists(fs afero.Fs, path string) (bool, error) {
+	var err error
+	if l, ok := fs.(afero.Lstater); ok {
+		_, _, err = l.LstatIfPossible(path)
+	} else {
+		_, err = fs.Stat(path)
+	}
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+// numberedName returns path with " (i)" before its extension.
+func numberedName(path string, i int) string {
+	dir, base := filepath.Split(path)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	if stem == "" {
+		// a dot file like .bashrc has no extension
+		stem, ext = base, ""
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, i, ext))
+}
+
+// freeName returns the first numbered variant of path that does not exist.
+func freeName(fs afero.Fs, path string) (string, error) {
+	for i := 1; ; i++ {
+		candidate := numberedName(path, i)
+		ok, err := lexists(fs, candidate)
+		if err != nil || !ok {
+			return candidate, err
+		}
+	}
+}
+
+// Resolve decides what to do with src whose destination dst exists. It
+// returns the path src goes to, or an empty path to skip src. Overwritten
+// entries are moved to the trash and recorded in journal.
+func (p conflictPolicy) Resolve(fs afero.Fs, src string, dst string, journal *journal) (string, error) {
+	decide := func(decision string, path string) (string, error) {
+		zap.L().Info("Destination exists", zap.String("policy", p.String()), zap.String("src", src),
+			zap.String("dst", dst), zap.String("decision", decision), zap.String("path", path))
+		return path, nil
+	}
+
+	switch p {
+	case conflictFail:
+		return "", errors.Wrapf(ErrFileExists, "path: %s", dst)
+	case conflictSkip:
+		return decide("skip", "")
+	case conflictOverwrite, conflictOverwriteIfNewer, conflictOverwriteIfLarger:
+		if p != conflictOverwrite {
+			srcInfo, err := fs.Stat(src)
+			if err != nil {
+				return "", err
+			}
+			dstInfo, err := fs.Stat(dst)
+			if err != nil {
+				return "", err
+			}
+			if p == conflictOverwriteIfNewer && !srcInfo.ModTime().After(dstInfo.ModTime()) {
+				return decide("skip, not newer", "")
+			}
+			if p == conflictOverwriteIfLarger && srcInfo.Size() <= dstInfo.Size() {
+				return decide("skip, not larger", "")
+			}
+		}
+		var err error
+		if _, ok := fs.(*afero.OsFs); ok {
+			err = trashOrDelete(dst, journal)
+		} else {
+			err = fs.RemoveAll(dst)
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "overwrite %s", dst)
+		}
+		return decide("overwrite", dst)
+	case conflictRename:
+		path, err := freeName(fs, dst)
+		if err != nil {
+			return "", err
+		}
+		return decide("rename", path)
+	case conflictRenameHash:
+		h, err := xxHashFile(src)
+		if err != nil {
+			return "", err
+		}
+		dir, base := filepath.Split(dst)
+		ext := filepath.Ext(base)
+		path := filepath.Join(dir, fmt.Sprintf("%s.%016x%s", strings.TrimSuffix(base, ext), h, ext))
+		ok, err := lexists(fs, path)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return decide("skip, already kept under its hash", "")
+		}
+		return decide("rename", path)
+	case conflictKeepBoth:
+		path := filepath.Join(filepath.Dir(dst), conflictDir, filepath.Base(dst))
+		ok, err := lexists(fs, path)
+		if err == nil && ok {
+			path, err = freeName(fs, path)
+		}
+		if err != nil {
+			return "", err
+		}
+		return decide("keep both", path)
+	}
+	return "", errors.Newf("unknown conflict policy: %d", p)
+}
+
+// claimDestination locks dst for src and resolves a conflict with what is
+// already there. It returns the path src goes to, empty to skip src, and
+// the function releasing the locks.
+func claimDestination(fs afero.Fs, policy conflictPolicy, src string, dst string,
+	journal *journal) (string, func(), error) {
+	unlock := dstLocks.Lock(dst)
+	ok, err := lexists(fs, dst)
+	if err != nil || !ok {
+		return dst, unlock, err
+	}
+
+	path, err := policy.Resolve(fs, src, dst, journal)
+	if err != nil || path == "" || path == dst {
+		return path, unlock, err
+	}
+	unlockPath := dstLocks.Lock(path)
+	return path, func() {
+		unlockPath()
+		unlock()
+	}, nil
+}
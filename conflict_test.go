@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type ConflictTestSuite struct {
+	suite.Suite
+	dir string
+	src string
+	dst string
+}
+
+func TestConflict(t *testing.T) {
+	suite.Run(t, new(ConflictTestSuite))
+}
+
+func (s *ConflictTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.T().Setenv("XDG_DATA_HOME", filepath.Join(s.dir, "data"))
+	s.src = s.write("src/a.txt", "new contents", time.Now())
+	s.dst = s.write("dst/a.txt", "old", time.Now().Add(-time.Hour))
+}
+
+func (s *ConflictTestSuite) write(name string, content string, mtime time.Time) string {
+	path := filepath.Join(s.dir, name)
+	s.Require().NoError(os.MkdirAll(filepath.Dir(path), 0755))
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0644))
+	s.Require().NoError(os.Chtimes(path, mtime, mtime))
+	return path
+}
+
+func (s *ConflictTestSuite) read(path string) string {
+	b, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	return string(b)
+}
+
+func (s *ConflictTestSuite) copyWith(policy conflictPolicy) error {
+	return CopyAction{dst: filepath.Dir(s.dst), conflict: policy}.Execute(s.src)
+}
+
+func (s *ConflictTestSuite) TestPolicyNames() {
+	for _, name := range conflictPolicyNames {
+		p, err := newConflictPolicy(name)
+		s.NoError(err)
+		s.Equal(name, p.String())
+	}
+	_, err := newConflictPolicy("merge")
+	s.Error(err)
+}
+
+func (s *ConflictTestSuite) TestFailAndSkip() {
+	s.ErrorIs(s.copyWith(conflictFail), ErrFileExists)
+	s.NoError(s.copyWith(conflictSkip))
+	s.Equal("old", s.read(s.dst))
+}
+
+func (s *ConflictTestSuite) TestOverwrite() {
+	s.NoError(s.copyWith(conflictOverwriteIfNewer))
+	s.Equal("new contents", s.read(s.dst))
+
+	// the destination is now newer and as large as the source
+	s.NoError(s.copyWith(conflictOverwriteIfNewer))
+	s.NoError(s.copyWith(conflictOverwriteIfLarger))
+	s.write("src/a.txt", "x", time.Now().Add(-2*time.Hour))
+	s.NoError(s.copyWith(conflictOverwriteIfLarger))
+	s.Equal("new contents", s.read(s.dst))
+
+	s.NoError(s.copyWith(conflictOverwrite))
+	s.Equal("x", s.read(s.dst))
+	// overwritten files go to the trash
+	s.FileExists(filepath.Join(s.dir, "data", "Trash", "files", "a.txt"))
+}
+
+func (s *ConflictTestSuite) TestRename() {
+	s.NoError(s.copyWith(conflictRename))
+	s.NoError(s.copyWith(conflictRename))
+	s.Equal("old", s.read(s.dst))
+	s.Equal("new contents", s.read(filepath.Join(s.dir, "dst", "a (1).txt")))
+	s.Equal("new contents", s.read(filepath.Join(s.dir, "dst", "a (2).txt")))
+	s.Equal(filepath.Join("d", ".bashrc (1)"), numberedName(filepath.Join("d", ".bashrc"), 1))
+}
+
+func (s *ConflictTestSuite) TestRenameHash() {
+	s.NoError(s.copyWith(conflictRenameHash))
+	s.NoError(s.copyWith(conflictRenameHash))
+	entries, err := os.ReadDir(filepath.Join(s.dir, "dst"))
+	s.Require().NoError(err)
+	s.Len(entries, 2)
+	s.Regexp(`^a\.[0-9a-f]{16}\.txt$`, entries[0].Name())
+}
+
+func (s *ConflictTestSuite) TestKeepBoth() {
+	s.NoError(s.copyWith(conflictKeepBoth))
+	s.NoError(s.copyWith(conflictKeepBoth))
+	s.Equal("new contents", s.read(filepath.Join(s.dir, "dst", conflictDir, "a.txt")))
+	s.Equal("new contents", s.read(filepath.Join(s.dir, "dst", conflictDir, "a (1).txt")))
+}
+
+func (s *ConflictTestSuite) TestMerge() {
+	s.write("src/b.txt", "old", time.Now())
+	s.write("dst/b.txt", "old", time.Now())
+	err := mergePath(afero.NewOsFs(), filepath.Join(s.dir, "dst"), filepath.Join(s.dir, "src"),
+		mergeOptions{conflict: conflictRename})
+	s.Require().NoError(err)
+
+	s.NoFileExists(s.src)
+	s.NoFileExists(filepath.Join(s.dir, "src", "b.txt"))
+	s.Equal("old", s.read(s.dst))
+	s.Equal("new contents", s.read(filepath.Join(s.dir, "dst", "a (1).txt")))
+	s.NoFileExists(filepath.Join(s.dir, "dst", "b (1).txt"))
+}
@@ -0,0 +1,484 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+	"go.uber.org/zap"
+)
+
+// archiveFormat is the format of a file as told by its first bytes.
+type archiveFormat int
+
+const (
+	formatUnknown archiveFormat = iota
+	formatZip
+	formatTar
+	formatGzip
+	formatBzip2
+	formatXz
+	formatZstd
+)
+
+// archiveHeadSize is what detectFormat needs to see, the magic of tar is
+// at offset 257.
+const archiveHeadSize = 512
+
+func detectFormat(head []byte) archiveFormat {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return formatZip
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return formatGzip
+	case bytes.HasPrefix(head, []byte("BZh")):
+		return formatBzip2
+	case bytes.HasPrefix(head, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return formatXz
+	case bytes.HasPrefix(head, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return formatZstd
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return formatTar
+	}
+	return formatUnknown
+}
+
+// newDecompressor returns the decompressed stream of r in format.
+func newDecompressor(format archiveFormat, r io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case formatGzip:
+		return gzip.NewReader(r)
+	case formatBzip2:
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case formatXz:
+		x, err := xz.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(x), nil
+	case formatZstd:
+		d, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+	return nil, errors.Newf("not a compressed format: %d", format)
+}
+
+var (
+	archiveSuffixes = []string{".tar.gz", ".tgz", ".tar.bz2", ".tbz2", ".tbz", ".tar.xz", ".txz",
+		".tar.zst", ".tzst", ".zip", ".tar"}
+	compressedSuffixes = []string{".gz", ".bz2", ".xz", ".zst"}
+)
+
+// trimSuffixes trims the first of suffixes name ends with, ignoring case.
+func trimSuffixes(name string, suffixes []string) string {
+	lower := strings.ToLower(name)
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return name[:len(name)-len(suffix)]
+		}
+	}
+	return name
+}
+
+// extractedPath returns the sibling of path its contents are extracted to,
+// the name of path without the archive or compression extension.
+func extractedPath(path string, suffixes []string, fallback string) string {
+	dir, base := filepath.Split(path)
+	name := trimSuffixes(base, suffixes)
+	if name == base || name == "" {
+		name = base + fallback
+	}
+	return filepath.Join(dir, name)
+}
+
+// ExtractAction extracts zip and tar archives, compressed or not, into a
+// directory next to them and decompresses single gzip, bzip2, xz and zstd
+// files. The original goes to the trash once its contents are in place.
+// Other files are left alone.
+type ExtractAction struct {
+	journal *journal
+	// gzipOnly limits the action to what gz always did, decompressing .gz
+	// files into a single file, tarballs included
+	gzipOnly bool
+}
+
+var (
+	_ Action        = &ExtractAction{}
+	_ plannedAction = &ExtractAction{}
+)
+
+func (a ExtractAction) Execute(path string) error {
+	dst, extract, done, err := a.open(path)
+	defer done()
+	if err != nil || dst == "" {
+		return err
+	}
+	return a.stage(path, dst, extract)
+}
+
+// Plan tells where path is extracted to by reading its head, files the
+// action leaves alone are not planned.
+func (a ExtractAction) Plan(path string) (planOperation, error) {
+	dst, _, done, err := a.open(path)
+	done()
+	if err != nil || dst == "" {
+		return planOperation{}, err
+	}
+	return planOperation{Op: opExtract, Dst: dst, GzipOnly: a.gzipOnly}, nil
+}
+
+// open detects the format of path and returns where it is extracted to and
+// the function extracting it into a part, dst is empty for files the action
+// leaves alone. done releases path and must always be called.
+func (a ExtractAction) open(path string) (dst string, extract func(part string) error, done func(), err error) {
+	done = func() {}
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", nil, done, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", nil, done, err
+	}
+	done = func() { _ = f.Close() }
+
+	head := make([]byte, archiveHeadSize)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", nil, done, err
+	}
+	format := detectFormat(head[:n])
+	if format == formatUnknown {
+		return "", nil, done, nil
+	}
+	if a.gzipOnly && (format != formatGzip || !strings.HasSuffix(strings.ToLower(path), ".gz")) {
+		return "", nil, done, nil
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", nil, done, err
+	}
+
+	switch format {
+	case formatZip:
+		return extractedPath(path, archiveSuffixes, ".extracted"), func(part string) error {
+			return extractZip(f, info.Size(), part)
+		}, done, nil
+	case formatTar:
+		return extractedPath(path, archiveSuffixes, ".extracted"), func(part string) error {
+			return extractTar(f, part)
+		}, done, nil
+	}
+
+	d, err := newDecompressor(format, f)
+	if err != nil {
+		return "", nil, done, errors.Wrapf(err, "decompress %s", path)
+	}
+	done = func() {
+		_ = d.Close()
+		_ = f.Close()
+	}
+	r := bufio.NewReaderSize(d, archiveHeadSize)
+	head, err = r.Peek(archiveHeadSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", nil, done, errors.Wrapf(err, "decompress %s", path)
+	}
+	if detectFormat(head) == formatTar && !a.gzipOnly {
+		return extractedPath(path, archiveSuffixes, ".extracted"), func(part string) error {
+			return extractTar(r, part)
+		}, done, nil
+	}
+	return extractedPath(path, compressedSuffixes, ".out"), func(part string) error {
+		return writeSynced(part, r, info.Mode().Perm())
+	}, done, nil
+}
+
+// stage extracts path with extract into a part next to dst, which becomes
+// dst once the extraction succeeded. Existing destinations are left alone.
+func (a ExtractAction) stage(path string, dst string, extract func(part string) error) error {
+	_, err := os.Lstat(dst)
+	if err == nil {
+		zap.L().Info("Already extracted", zap.String("path", path), zap.String("dst", dst))
+		return nil
+	}
+
+	// what an interrupted extraction left cannot be resumed
+	part := partPathOf(dst)
+	err = os.RemoveAll(part)
+	if err != nil {
+		return err
+	}
+	err = extract(part)
+	if err == nil {
+		err = os.Rename(part, dst)
+	}
+	if err != nil {
+		_ = os.RemoveAll(part)
+		return errors.Wrapf(err, "extract %s", path)
+	}
+	err = syncDir(filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+
+	zap.L().Info("Extracted", zap.String("path", path), zap.String("dst", dst))
+	return trashOrDelete(path, a.journal)
+}
+
+// writeSynced writes r to the new file path and syncs it.
+func writeSynced(path string, r io.Reader, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// archiveDir is a directory archive entries are extracted to. Entries are
+// created through an os.Root, so neither their names nor symbolic links
+// extracted before them can place anything outside of it (zip-slip).
+type archiveDir struct {
+	dir  string
+	root *os.Root
+}
+
+func newArchiveDir(dir string) (*archiveDir, error) {
+	err := os.Mkdir(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveDir{dir: dir, root: root}, nil
+}
+
+func (d *archiveDir) Close() error {
+	return d.root.Close()
+}
+
+// entryName returns the local path of an archive entry name, or an error
+// if it is absolute or leaves the directory.
+func entryName(name string) (string, error) {
+	p := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(name, "./")))
+	if !filepath.IsLocal(p) {
+		return "", errors.Newf("archive entry outside of the archive: %s", name)
+	}
+	return p, nil
+}
+
+// MkdirAll creates the directory name and its parents.
+func (d *archiveDir) MkdirAll(name string) error {
+	if name == "." {
+		return nil
+	}
+	err := d.MkdirAll(filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+	err = d.root.Mkdir(name, 0755)
+	if errors.Is(err, os.ErrExist) {
+		info, statErr := d.root.Stat(name)
+		if statErr == nil && info.IsDir() {
+			return nil
+		}
+	}
+	return err
+}
+
+// WriteFile creates the file name with the contents of r.
+func (d *archiveDir) WriteFile(name string, r io.Reader, perm os.FileMode, mtime time.Time) error {
+	err := d.MkdirAll(filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+	if perm == 0 {
+		// archives made on Windows often have no permissions
+		perm = 0644
+	}
+	f, err := d.root.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm&os.ModePerm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || mtime.IsZero() {
+		return err
+	}
+	return os.Chtimes(filepath.Join(d.dir, name), mtime, mtime)
+}
+
+// checkParents returns an error if a parent of name is a symbolic link.
+// Links created below one would resolve relative to where it points, which
+// the checks of their targets cannot see.
+func (d *archiveDir) checkParents(name string) error {
+	for p := filepath.Dir(name); p != "."; p = filepath.Dir(p) {
+		info, err := d.root.Lstat(p)
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return errors.Newf("archive entry below a symbolic link: %s", name)
+		}
+	}
+	return nil
+}
+
+// Symlink creates the symbolic link name, its target must stay inside the
+// directory too. The target may only go up before it goes down, a ".."
+// after a symbolic link in it would leave from wherever that one points.
+func (d *archiveDir) Symlink(name string, target string) error {
+	target = filepath.FromSlash(target)
+	if filepath.IsAbs(target) || !filepath.IsLocal(filepath.Join(filepath.Dir(name), target)) {
+		return errors.Newf("symbolic link outside of the archive: %s -> %s", name, target)
+	}
+	up := true
+	for _, c := range strings.Split(target, string(filepath.Separator)) {
+		if c == ".." && !up {
+			return errors.Newf("symbolic link outside of the archive: %s -> %s", name, target)
+		}
+		up = up && (c == ".." || c == "." || c == "")
+	}
+	err := d.MkdirAll(filepath.Dir(name))
+	if err == nil {
+		err = d.checkParents(name)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Symlink(target, filepath.Join(d.dir, name))
+}
+
+// Link creates the hard link name to the entry target extracted before.
+func (d *archiveDir) Link(name string, target string) error {
+	target, err := entryName(target)
+	if err != nil {
+		return err
+	}
+	err = d.MkdirAll(filepath.Dir(name))
+	if err == nil {
+		err = d.checkParents(name)
+	}
+	if err == nil {
+		err = d.checkParents(target)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Link(filepath.Join(d.dir, target), filepath.Join(d.dir, name))
+}
+
+func extractTar(r io.Reader, dir string) error {
+	d, err := newArchiveDir(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Close() }()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name, err := entryName(hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = d.MkdirAll(name)
+		case tar.TypeReg:
+			err = d.WriteFile(name, tr, hdr.FileInfo().Mode().Perm(), hdr.ModTime)
+		case tar.TypeSymlink:
+			err = d.Symlink(name, hdr.Linkname)
+		case tar.TypeLink:
+			err = d.Link(name, hdr.Linkname)
+		default:
+			zap.L().Warn("Skipping archive entry", zap.String("name", hdr.Name),
+				zap.String("type", string(hdr.Typeflag)))
+		}
+		if err != nil {
+			return errors.Wrapf(err, "entry %s", hdr.Name)
+		}
+	}
+}
+
+// maxZipLinkSize limits what is read as the target of a symbolic link.
+const maxZipLinkSize = 4096
+
+func extractZip(r io.ReaderAt, size int64, dir string) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return err
+	}
+	d, err := newArchiveDir(dir)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = d.Close() }()
+
+	for _, f := range zr.File {
+		name, err := entryName(f.Name)
+		if err != nil {
+			return err
+		}
+		err = extractZipEntry(d, f, name)
+		if err != nil {
+			return errors.Wrapf(err, "entry %s", f.Name)
+		}
+	}
+	return nil
+}
+
+func extractZipEntry(d *archiveDir, f *zip.File, name string) error {
+	mode := f.Mode()
+	if mode.IsDir() {
+		return d.MkdirAll(name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rc.Close() }()
+
+	if mode&os.ModeSymlink != 0 {
+		target, err := io.ReadAll(io.LimitReader(rc, maxZipLinkSize))
+		if err != nil {
+			return err
+		}
+		return d.Symlink(name, string(target))
+	}
+	return d.WriteFile(name, rc, mode.Perm(), f.Modified)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/suite"
+	"github.com/ulikunitz/xz"
+)
+
+// bzip2TarHex is a tar with a.txt containing "bzipped\n", compressed with
+// bzip2, which the standard library cannot write.
+const bzip2TarHex = "425a6839314159265359a96424fe00006e7b80ca90001040016780000876205e50080820005442691a0f" +
+	"5346351a686f5412493d468d0d00007dd48821045d0845fcceb2326a902183681acdf1643b0864324e195b2841e854a0e" +
+	"fc0ef65703eba8dcccc8bf177245385090a96424fe0"
+
+type ExtractTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func TestExtract(t *testing.T) {
+	suite.Run(t, new(ExtractTestSuite))
+}
+
+func (s *ExtractTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.T().Setenv("XDG_DATA_HOME", filepath.Join(s.dir, "data"))
+}
+
+func (s *ExtractTestSuite) write(name string, content []byte) string {
+	path := filepath.Join(s.dir, name)
+	s.Require().NoError(os.WriteFile(path, content, 0644))
+	return path
+}
+
+func (s *ExtractTestSuite) read(name string) string {
+	b, err := os.ReadFile(filepath.Join(s.dir, name))
+	s.Require().NoError(err)
+	return string(b)
+}
+
+type tarEntry struct {
+	hdr     tar.Header
+	content string
+}
+
+func (s *ExtractTestSuite) tar(entries ...tarEntry) []byte {
+	var b bytes.Buffer
+	w := tar.NewWriter(&b)
+	for _, e := range entries {
+		hdr := e.hdr
+		hdr.Size = int64(len(e.content))
+		if hdr.Mode == 0 {
+			hdr.Mode = 0644
+		}
+		s.Require().NoError(w.WriteHeader(&hdr))
+		_, err := w.Write([]byte(e.content))
+		s.Require().NoError(err)
+	}
+	s.Require().NoError(w.Close())
+	return b.Bytes()
+}
+
+func (s *ExtractTestSuite) sample() []byte {
+	return s.tar(
+		tarEntry{hdr: tar.Header{Name: "./d/", Typeflag: tar.TypeDir, Mode: 0755}},
+		tarEntry{hdr: tar.Header{Name: "./d/a.txt", Typeflag: tar.TypeReg}, content: "a"},
+		tarEntry{hdr: tar.Header{Name: "./link", Typeflag: tar.TypeSymlink, Linkname: "d/a.txt"}},
+		tarEntry{hdr: tar.Header{Name: "./hard", Typeflag: tar.TypeLink, Linkname: "d/a.txt"}},
+	)
+}
+
+func (s *ExtractTestSuite) extract(path string) {
+	s.Require().NoError(ExtractAction{}.Execute(path))
+	s.NoFileExists(path)
+	s.FileExists(filepath.Join(s.dir, "data", "Trash", "files", filepath.Base(path)))
+}
+
+func (s *ExtractTestSuite) TestDetectFormat() {
+	s.Equal(formatUnknown, detectFormat([]byte("plain text")))
+	s.Equal(formatTar, detectFormat(s.sample()))
+	s.Equal(formatZip, detectFormat([]byte("PK\x03\x04")))
+	s.Equal(formatBzip2, detectFormat([]byte("BZh9")))
+}
+
+func (s *ExtractTestSuite) TestTar() {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, err := w.Write(s.sample())
+	s.Require().NoError(err)
+	s.Require().NoError(w.Close())
+
+	s.extract(s.write("a.tar.gz", gz.Bytes()))
+	s.Equal("a", s.read("a/d/a.txt"))
+	s.Equal("a", s.read("a/link"))
+	s.Equal("a", s.read("a/hard"))
+	target, err := os.Readlink(filepath.Join(s.dir, "a/link"))
+	s.NoError(err)
+	s.Equal("d/a.txt", target)
+	s.NoDirExists(partPathOf(filepath.Join(s.dir, "a")))
+}
+
+func (s *ExtractTestSuite) TestCompressedTar() {
+	var x bytes.Buffer
+	xw, err := xz.NewWriter(&x)
+	s.Require().NoError(err)
+	_, err = xw.Write(s.sample())
+	s.Require().NoError(err)
+	s.Require().NoError(xw.Close())
+	s.extract(s.write("x.txz", x.Bytes()))
+	s.Equal("a", s.read("x/d/a.txt"))
+
+	var z bytes.Buffer
+	zw, err := zstd.NewWriter(&z)
+	s.Require().NoError(err)
+	_, err = zw.Write(s.sample())
+	s.Require().NoError(err)
+	s.Require().NoError(zw.Close())
+	s.extract(s.write("z.tar.zst", z.Bytes()))
+	s.Equal("a", s.read("z/d/a.txt"))
+
+	b, err := hex.DecodeString(bzip2TarHex)
+	s.Require().NoError(err)
+	s.extract(s.write("b.tar.bz2", b))
+	s.Equal("bzipped\n", s.read("b/a.txt"))
+}
+
+func (s *ExtractTestSuite) TestGzipOnly() {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, err := w.Write(s.sample())
+	s.Require().NoError(err)
+	s.Require().NoError(w.Close())
+	action, err := newAction("gz", actionOptions{})
+	s.Require().NoError(err)
+
+	path := s.write("g.tar.gz", gz.Bytes())
+	s.Require().NoError(action.Execute(path))
+	s.NoFileExists(path)
+	s.Equal(string(s.sample()), s.read("g.tar"))
+
+	path = s.write("t.tar", s.sample())
+	s.Require().NoError(action.Execute(path))
+	s.FileExists(path)
+	s.NoDirExists(filepath.Join(s.dir, "t"))
+}
+
+func (s *ExtractTestSuite) TestPlan() {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, err := w.Write(s.sample())
+	s.Require().NoError(err)
+	s.Require().NoError(w.Close())
+	archive := s.write("a.tar.gz", gz.Bytes())
+	s.write("plain.txt", []byte("plain text"))
+
+	p := newPlan(filepath.Join(s.dir, "plan.json"))
+	for _, name := range []string{"extract", "gz"} {
+		action, err := newAction(name, actionOptions{})
+		s.Require().NoError(err)
+		planned, err := newPlanAction(action, p)
+		s.Require().NoError(err)
+		s.Require().NoError(planned.Execute(archive))
+		s.Require().NoError(planned.Execute(filepath.Join(s.dir, "plain.txt")))
+	}
+	s.Require().Len(p.operations, 2)
+	s.Equal(planOperation{Op: opExtract, Dst: filepath.Join(s.dir, "a")},
+		planOperation{Op: p.operations[0].Op, Dst: p.operations[0].Dst, GzipOnly: p.operations[0].GzipOnly})
+	s.Equal(filepath.Join(s.dir, "a.tar"), p.operations[1].Dst)
+	s.True(p.operations[1].GzipOnly)
+	s.FileExists(archive)
+	s.NoDirExists(filepath.Join(s.dir, "a"))
+
+	s.Require().NoError(applyOperation(p.operations[0], nil, nil))
+	s.Equal("a", s.read("a/d/a.txt"))
+	s.NoFileExists(archive)
+	s.ErrorIs(applyOperation(p.operations[1], nil, nil), os.ErrNotExist)
+}
+
+func (s *ExtractTestSuite) TestZip() {
+	var b bytes.Buffer
+	w := zip.NewWriter(&b)
+	f, err := w.Create("dir/x.txt")
+	s.Require().NoError(err)
+	_, err = io.WriteString(f, "zipped")
+	s.Require().NoError(err)
+	s.Require().NoError(w.Close())
+
+	s.extract(s.write("z.zip", b.Bytes()))
+	s.Equal("zipped", s.read("z/dir/x.txt"))
+}
+
+func (s *ExtractTestSuite) TestSingleFile() {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, err := w.Write([]byte("single"))
+	s.Require().NoError(err)
+	s.Require().NoError(w.Close())
+
+	s.extract(s.write("one.txt.gz", gz.Bytes()))
+	s.Equal("single", s.read("one.txt"))
+
+	// existing destinations and other files are left alone
+	path := s.write("two.txt.gz", gz.Bytes())
+	s.write("two.txt", []byte("kept"))
+	s.NoError(ExtractAction{}.Execute(path))
+	s.FileExists(path)
+	s.Equal("kept", s.read("two.txt"))
+	path = s.write("plain.txt", []byte("plain"))
+	s.NoError(ExtractAction{}.Execute(path))
+	s.FileExists(path)
+}
+
+func (s *ExtractTestSuite) TestZipSlip() {
+	for _, entries := range [][]tarEntry{
+		{{hdr: tar.Header{Name: "../evil.txt", Typeflag: tar.TypeReg}, content: "evil"}},
+		{{hdr: tar.Header{Name: "/evil.txt", Typeflag: tar.TypeReg}, content: "evil"}},
+		{{hdr: tar.Header{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "/tmp"}}},
+		{{hdr: tar.Header{Name: "d/l", Typeflag: tar.TypeSymlink, Linkname: "../.."}}},
+		{{hdr: tar.Header{Name: "h", Typeflag: tar.TypeLink, Linkname: "../evil.txt"}}},
+		{
+			{hdr: tar.Header{Name: "l1", Typeflag: tar.TypeSymlink, Linkname: "."}},
+			{hdr: tar.Header{Name: "l1/esc", Typeflag: tar.TypeSymlink, Linkname: ".."}},
+		},
+		{
+			{hdr: tar.Header{Name: "l1", Typeflag: tar.TypeSymlink, Linkname: "."}},
+			{hdr: tar.Header{Name: "esc", Typeflag: tar.TypeSymlink, Linkname: "l1/../evil"}},
+		},
+		{
+			{hdr: tar.Header{Name: "a.txt", Typeflag: tar.TypeReg}, content: "a"},
+			{hdr: tar.Header{Name: "l1", Typeflag: tar.TypeSymlink, Linkname: "."}},
+			{hdr: tar.Header{Name: "l1/h", Typeflag: tar.TypeLink, Linkname: "a.txt"}},
+		},
+	} {
+		path := s.write("evil.tar", s.tar(entries...))
+		s.Error(ExtractAction{}.Execute(path))
+		s.FileExists(path)
+		s.NoFileExists(filepath.Join(filepath.Dir(s.dir), "evil.txt"))
+		s.NoDirExists(filepath.Join(s.dir, "evil"))
+		s.NoDirExists(partPathOf(filepath.Join(s.dir, "evil")))
+	}
+}
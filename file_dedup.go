@@ -10,13 +10,12 @@ import (
 	"io"
 	"io/fs"
 	"os"
-	"path/filepath"
 	"time"
 
 	"github.com/cespare/xxhash"
-	"github.com/laurent22/go-trash"
 	"github.com/opencontainers/selinux/pkg/pwalkdir"
 	"github.com/schollz/progressbar/v3"
+	"github.com/spf13/afero"
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/urfave/cli/v3"
 	"go.uber.org/zap"
@@ -35,13 +34,24 @@ var cmdDeduplicateFile = &cli.Command{
 			Config: cli.StringConfig{TrimSpace: true},
 		},
 	},
+	Flags: []cli.Flag{journalFlag(), planFlag(), respectIgnoreFlag()},
 	Action: func(ctx context.Context, command *cli.Command) error {
 		path1 := command.StringArg("path1")
 		path2 := command.StringArg("path2")
 		if path1 == "" || path2 == "" {
 			return errors.New("path1 or path2 required")
 		}
-		return deduplicate(path1, path2)
+		journal, err := openJournal(command.String("journal"))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = journal.Close() }()
+		plan := newPlan(command.String("plan"))
+		err = deduplicate(path1, path2, newRespectIgnoreOptions(command), journal, plan)
+		if err != nil {
+			return err
+		}
+		return plan.Save()
 	},
 }
 
@@ -105,7 +115,7 @@ func (h *multiHash) Bytes() []byte {
 	return buf
 }
 
-func createHashMap(path string, db *leveldb.DB) error {
+func createHashMap(path string, db *leveldb.DB, opts ignoreOptions) error {
 	bar := progressbar.NewOptions(-1,
 		progressbar.OptionEnableColorCodes(true),
 		progressbar.OptionShowCount(),
@@ -114,6 +124,8 @@ func createHashMap(path string, db *leveldb.DB) error {
 	bar.Describe(fmt.Sprintf("Creating deduplicate hash map, path: %s", path))
 	defer func() { _ = bar.Finish() }()
 
+	// pwalkdir does not support fs.SkipDir, ignoreRules checks the parents instead
+	ignore := newIgnoreRules(afero.NewOsFs(), path, opts)
 	return pwalkdir.Walk(path, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
@@ -121,6 +133,10 @@ func createHashMap(path string, db *leveldb.DB) error {
 		if d.IsDir() {
 			return nil
 		}
+		ignored, err := ignore.Ignored(path, false)
+		if err != nil || ignored {
+			return err
+		}
 
 		h, err := hashFile(path)
 		if err != nil {
@@ -131,7 +147,9 @@ func createHashMap(path string, db *leveldb.DB) error {
 	})
 }
 
-func deduplicate(path1 string, path2 string) error {
+// deduplicate removes the files of path2 that also exist in path1, or adds
+// their removal to plan if it is not nil.
+func deduplicate(path1 string, path2 string, opts ignoreOptions, journal *journal, plan *plan) error {
 	dbPath1, err := os.MkdirTemp("", "gofd-")
 	if err != nil {
 		return err
@@ -143,7 +161,7 @@ func deduplicate(path1 string, path2 string) error {
 	}
 	defer func() { _ = db1.Close() }()
 
-	err = createHashMap(path1, db1)
+	err = createHashMap(path1, db1, opts)
 	if err != nil {
 		return err
 	}
@@ -159,7 +177,7 @@ func deduplicate(path1 string, path2 string) error {
 	}
 	defer func() { _ = db1.Close() }()
 
-	err = createHashMap(path2, db2)
+	err = createHashMap(path2, db2, opts)
 	if err != nil {
 		return err
 	}
@@ -169,7 +187,7 @@ func deduplicate(path1 string, path2 string) error {
 		key := iter.Key()
 		path := iter.Value()
 
-		_, err = db1.Get(key, nil)
+		dup, err := db1.Get(key, nil)
 		if err != nil {
 			if errors.Is(err, leveldb.ErrNotFound) {
 				continue
@@ -178,15 +196,17 @@ func deduplicate(path1 string, path2 string) error {
 			}
 		} else {
 			p := string(path)
-			zap.L().Info("Removing file", zap.String("path", p))
-			if trash.IsAvailable() {
-				p, err = filepath.Abs(p)
+			if plan != nil {
+				err = plan.Add(opRemoveDuplicate, p, string(dup))
 				if err != nil {
-					panic(err)
+					return err
 				}
-				_, _ = trash.MoveToTrash(p)
-			} else {
-				_ = os.Remove(p)
+				continue
+			}
+			zap.L().Info("Removing file", zap.String("path", p))
+			err = trashOrDelete(p, journal)
+			if err != nil {
+				zap.L().Warn("Remove failed", zap.String("path", p), zap.Error(err))
 			}
 		}
 	}
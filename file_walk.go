@@ -1,240 +1,727 @@
 package main
 
 import (
-	"compress/gzip"
 	"context"
-	"database/sql"
 	"fmt"
-	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/cockroachdb/errors"
-	"github.com/gobwas/glob"
-	"github.com/laurent22/go-trash"
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/spf13/afero"
 	"github.com/urfave/cli/v3"
 	"go.uber.org/zap"
 )
 
 type exclude struct {
-	patterns []glob.Glob
+	patterns []stringMatcher
+	on       matchOn
 }
 
-func (e exclude) Match(path string) bool {
+func (e exclude) Match(root string, path string) bool {
 	if len(e.patterns) == 0 {
 		return false
 	}
+	subject := e.on.Subject(root, path)
 	for _, pattern := range e.patterns {
-		if pattern.Match(path) {
+		if pattern.Match(subject) {
 			return true
 		}
 	}
 	return false
 }
 
-func newExclude(patterns []string) *exclude {
-	p := make([]glob.Glob, len(patterns))
+func newExclude(patterns []string, regex bool, ignoreCase bool, on matchOn) (*exclude, error) {
+	p := make([]stringMatcher, len(patterns))
 	for i, pattern := range patterns {
-		g, err := glob.Compile(pattern)
+		m, err := compilePattern(pattern, regex, ignoreCase)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		p[i] = g
+		p[i] = m
 	}
-	return &exclude{p}
+	return &exclude{patterns: p, on: on}, nil
 }
 
 var cmdFind = &cli.Command{
 	Name: "find",
 	Arguments: []cli.Argument{
-		&cli.StringArg{Name: "path"},
+		&cli.StringArgs{Name: "path", Max: -1},
 	},
-	Flags: []cli.Flag{
+	Flags: append([]cli.Flag{
 		&cli.StringFlag{
 			Name:    "glob",
 			Aliases: []string{"g"},
 			Value:   "*",
 		},
+		&cli.StringFlag{
+			Name:    "regex",
+			Aliases: []string{"r"},
+			Usage:   "match with a regular expression instead of --glob, excludes are regular expressions too",
+		},
+		&cli.StringFlag{
+			Name:  "match-on",
+			Usage: "part of the path patterns are matched against: basename, path or relpath",
+			Value: "path",
+		},
+		&cli.BoolFlag{
+			Name:    "ignore-case",
+			Aliases: []string{"i"},
+		},
 		&cli.StringFlag{
 			Name:    "action",
 			Aliases: []string{"x"},
+			Usage: "print (default), omit, rm/delete, extract, gz, move-to:DIR, copy-to:DIR, move-tree-to:DIR, " +
+				"copy-tree-to:DIR, exec:CMD or exec-batch:CMD, the tree variants keep the path relative to the root",
+		},
+		&cli.BoolFlag{
+			Name:  "preserve",
+			Usage: "keep mode, ownership, timestamps and xattrs of the files copied by the copy actions, moves always keep them",
 		},
 		&cli.StringFlag{
+			Name:    "format",
+			Aliases: []string{"f"},
+			Usage:   "output format of the print action: plain, json, jsonl or csv",
+			Value:   "plain",
+		},
+		&cli.StringSliceFlag{
+			Name:    "columns",
+			Aliases: []string{"c"},
+			Usage:   "metadata columns to print: size, mode, mtime, inode, xxhash",
+		},
+		&cli.StringFlag{
+			Name:  "template",
+			Usage: "print every match through a Go text/template, e.g. '{{.RelPath}}\t{{.Size | human}}'",
+		},
+		&cli.BoolFlag{
+			Name:  "print0",
+			Usage: "separate plain output with NUL instead of newline",
+		},
+		&cli.StringSliceFlag{
 			Name:    "type",
 			Aliases: []string{"t"},
+			Usage: "file (f), dir (d), empty, empty-file, symlink (l), broken-symlink, executable (x), " +
+				"socket (s), fifo (p), block-device (b) or char-device (c), may be repeated",
+		},
+		&cli.StringFlag{
+			Name:    "where",
+			Aliases: []string{"w"},
+			Usage:   `boolean expression over name, ext, path, type, size, depth, mtime and age, e.g. 'ext in ["log", "tmp"] and age > 30d'`,
+		},
+		&cli.StringFlag{
+			Name:  "contains",
+			Usage: "regular expression the file contents must match, binary files are skipped",
+		},
+		&cli.BoolFlag{
+			Name:  "binary",
+			Usage: "search binary files with --contains too",
+		},
+		&cli.BoolFlag{
+			Name:  "files-without-match",
+			Usage: "invert --contains, match files whose contents do not match",
+		},
+		&cli.StringFlag{
+			Name:  "owner",
+			Usage: "owned by user, user:group or :group, names or numeric IDs",
+		},
+		&cli.BoolFlag{
+			Name:  "nouser",
+			Usage: "owned by a UID without a user",
+		},
+		&cli.BoolFlag{
+			Name:  "nogroup",
+			Usage: "owned by a GID without a group",
+		},
+		&cli.StringFlag{
+			Name:  "perm",
+			Usage: "octal permission bits, exactly MODE, all of -MODE or any of /MODE",
+		},
+		&cli.StringFlag{
+			Name:  "nlink",
+			Usage: "number of hard links, exactly N, more than +N or less than -N",
 		},
 		&cli.StringSliceFlag{
 			Name:    "excludes",
 			Aliases: []string{"e"},
 		},
+		&cli.StringSliceFlag{
+			Name:    "size",
+			Aliases: []string{"S"},
+			Usage:   "filter by file size, e.g. +2G (larger), -4k (smaller), 10M..100M (inclusive)",
+		},
+		&cli.StringFlag{
+			Name:  "changed-within",
+			Usage: "modified within a duration (7d, 12h) or after a date",
+		},
+		&cli.StringFlag{
+			Name:  "changed-before",
+			Usage: "modified longer ago than a duration or before a date",
+		},
+		&cli.StringFlag{
+			Name:  "accessed-before",
+			Usage: "accessed longer ago than a duration or before a date",
+		},
+		&cli.StringFlag{
+			Name:  "newer",
+			Usage: "modified more recently than the reference file",
+		},
+		&cli.IntFlag{
+			Name:  "max-depth",
+			Usage: "do not descend more than this many levels below the root",
+			Value: -1,
+		},
+		&cli.IntFlag{
+			Name:  "min-depth",
+			Usage: "only report entries at least this many levels below the root",
+		},
+		&cli.BoolFlag{
+			Name:  "one-file-system",
+			Usage: "do not descend into directories on other file systems",
+		},
+		&cli.StringFlag{
+			Name:  "sort",
+			Usage: "sort matches by name, size, mtime, depth or ext before running the action",
+		},
+		&cli.BoolFlag{
+			Name:  "reverse",
+			Usage: "reverse the --sort order",
+		},
+		&cli.IntFlag{
+			Name:  "limit",
+			Usage: "stop after this many matches, or keep only the first ones with --sort",
+		},
+		&cli.BoolFlag{
+			Name:  "first",
+			Usage: "stop after the first match, same as --limit 1",
+		},
+		&cli.IntFlag{
+			Name:    "jobs",
+			Aliases: []string{"j"},
+			Usage:   "number of actions executed concurrently, print and template write in order",
+			Value:   runtime.NumCPU(),
+		},
+		&cli.BoolFlag{
+			Name:  "from-stdin",
+			Usage: "read paths to check from stdin, one per line",
+		},
+		&cli.StringFlag{
+			Name:  "from-file",
+			Usage: "read paths to check from a file, one per line, - is stdin",
+		},
+		&cli.BoolFlag{
+			Name:  "read0",
+			Usage: "paths read by --from-stdin or --from-file are NUL separated, e.g. from find -print0",
+		},
 		&cli.StringFlag{
 			Name: "base-dir",
 		},
+		&cli.StringFlag{
+			Name:  "driver",
+			Usage: "database/sql driver of --dsn",
+			Value: "sqlite3",
+		},
 		&cli.StringFlag{
 			Name: "dsn",
 		},
 		&cli.StringFlag{
-			Name: "sql",
+			Name:  "sql",
+			Usage: "query returning a path column, and optionally action, gofd_dir and gofd_name columns",
 		},
-	},
+		&cli.StringSliceFlag{
+			Name:  "param",
+			Usage: "named parameter of --sql as name=value, may be repeated",
+		},
+		reflinkFlag(),
+		conflictFlag("fail"),
+		journalFlag(),
+		planFlag(),
+	}, ignoreFlags()...),
 	Action: func(ctx context.Context, command *cli.Command) error {
-		path := command.StringArg("path")
-		action := newAction(command.String("action"))
-		searchMode := newSearchType(command.String("type"))
-		exclude := newExclude(command.StringSlice("excludes"))
-
 		dsn := command.String("dsn")
 		sqlStatement := command.String("sql")
 		if (dsn == "" && sqlStatement != "") || (dsn != "" && sqlStatement == "") {
 			return errors.New("dsn or sql statement both required")
 		}
 
-		globStr := command.String("glob")
-		matcher, err := glob.Compile(globStr)
+		listFile := command.String("from-file")
+		if command.Bool("from-stdin") {
+			if listFile != "" && listFile != "-" {
+				return errors.New("--from-stdin and --from-file are exclusive")
+			}
+			listFile = "-"
+		}
+		listSep := byte('\n')
+		if command.Bool("read0") {
+			listSep = 0
+		}
+
+		walkRoots := command.StringArgs("path")
+		if len(walkRoots) == 0 && dsn == "" && listFile == "" {
+			walkRoots = []string{"."}
+		}
+		walkRoots, err := dedupeRoots(walkRoots)
 		if err != nil {
 			return err
 		}
 
-		pathList := make([]string, 0)
+		// roots are what relative paths and depths are computed against
+		roots := walkRoots
+		if baseDir := command.String("base-dir"); dsn != "" && baseDir != "" {
+			roots = append(roots[:len(roots):len(roots)], baseDir)
+		}
 
-		if dsn != "" {
-			db, err := sql.Open("sqlite3", dsn)
+		on, err := newMatchOn(command.String("match-on"))
+		if err != nil {
+			return err
+		}
+		regex := command.String("regex")
+		ignoreCase := command.Bool("ignore-case")
+		exclude, err := newExclude(command.StringSlice("excludes"), regex != "", ignoreCase, on)
+		if err != nil {
+			return err
+		}
+
+		var matcher stringMatcher
+		if regex != "" {
+			matcher, err = compilePattern(regex, true, ignoreCase)
+		} else {
+			matcher, err = compilePattern(command.String("glob"), false, ignoreCase)
+		}
+		if err != nil {
+			return err
+		}
+
+		filters, contains, err := newFindFilters(command, roots, ignoreCase)
+		if err != nil {
+			return err
+		}
+
+		var printer Action
+		actionName := command.String("action")
+		isPrint := actionName == "" || actionName == "print"
+		if isPrint || dsn != "" {
+			// rows of the SQL source may ask for the print action too
+			if !isPrint {
+				contains = nil
+			}
+			printer, err = newFindPrinter(command, roots, contains)
 			if err != nil {
 				return err
 			}
-			defer func() { _ = db.Close() }()
+		}
+		journal, err := openJournal(command.String("journal"))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = journal.Close() }()
+		conflict, err := newConflictPolicy(command.String("on-conflict"))
+		if err != nil {
+			return err
+		}
+		reflink, err := newReflinkMode(command.String("reflink"))
+		if err != nil {
+			return err
+		}
+		plan := newPlan(command.String("plan"))
+		if plan != nil && command.IsSet("on-conflict") {
+			return errors.New("--on-conflict cannot be planned, apply fails on existing destinations")
+		}
+		actionOpts := actionOptions{
+			printer:  printer,
+			journal:  journal,
+			roots:    roots,
+			preserve: command.Bool("preserve"),
+			conflict: conflict,
+			reflink:  reflink,
+		}
+		action, err := newAction(actionName, actionOpts)
+		if err != nil {
+			return err
+		}
+		planned, err := newPlanAction(action, plan)
+		if err != nil {
+			return err
+		}
 
-			rows, err := db.Query(sqlStatement)
+		key, err := newSortKey(command.String("sort"))
+		if err != nil {
+			return err
+		}
+		limit := command.Int("limit")
+		if command.Bool("first") {
+			limit = 1
+		}
+		jobs := command.Int("jobs")
+		if key != sortNone {
+			// the action sees the entries in order, so run it sequentially
+			jobs = 1
+		}
+
+		f := &finder{
+			matcher:       matcher,
+			on:            on,
+			exclude:       exclude,
+			filters:       filters,
+			ignore:        newIgnoreOptions(command),
+			maxDepth:      command.Int("max-depth"),
+			minDepth:      command.Int("min-depth"),
+			oneFileSystem: command.Bool("one-file-system"),
+			limit:         limit,
+			actionOpts:    actionOpts,
+			base:          action,
+			plan:          plan,
+			runner:        newActionRunner(planned, jobs),
+		}
+		if key != sortNone {
+			f.sorter = newEntrySorter(key, command.Bool("reverse"), limit)
+		}
+		err = f.pruneDestination(action)
+		if err != nil {
+			return err
+		}
+
+		var src *sqlSource
+		if dsn != "" {
+			params, err := parseSQLParams(command.StringSlice("param"))
 			if err != nil {
 				return err
 			}
-			defer func() { _ = rows.Close() }()
-
-			baseDir := command.String("base-dir")
-			for rows.Next() {
-				var p string
-				err = rows.Scan(&p)
-				if err != nil {
-					return err
-				}
-				if baseDir != "" {
-					p = filepath.Join(baseDir, p)
-				}
-				pathList = append(pathList, p)
+			src = &sqlSource{
+				driver:    command.String("driver"),
+				dsn:       dsn,
+				statement: sqlStatement,
+				baseDir:   command.String("base-dir"),
+				params:    params,
 			}
-		} else {
-			err = filepath.WalkDir(path, func(path string, info os.DirEntry, err error) error {
-				if err != nil {
-					return err
-				}
+		}
 
-				switch searchMode {
-				case onlyFile:
-					if info.IsDir() {
-						return nil
-					}
-				case onlyDir:
-					if !info.IsDir() {
-						return nil
-					}
-				case onlyEmptyDir:
-					if !info.IsDir() {
-						return nil
-					}
-
-					ents, err := os.ReadDir(path)
-					if err != nil {
-						return err
-					} else if len(ents) >= 1 {
-						return nil
-					}
-
-				case fileAndDir:
-				default:
-				}
+		err = f.run(walkRoots, listFile, listSep, src)
+		if errors.Is(err, errLimitReached) {
+			err = nil
+		}
+		f.flush()
+		runErr := f.runner.Wait()
+		f.runner.Summary(os.Stderr)
+		if err != nil {
+			return err
+		}
+		if runErr != nil {
+			return runErr
+		}
+		return plan.Save()
+	},
+}
 
-				if matcher.Match(path) && !exclude.Match(path) {
-					pathList = append(pathList, path)
-				}
+// newFindFilters builds the predicates of cmdFind. The --contains filter is
+// also returned on its own, so the output can report its matches.
+func newFindFilters(command *cli.Command, roots []string, ignoreCase bool) (entryFilters, *contentFilter, error) {
+	searchMode, err := newSearchTypes(command.StringSlice("type"))
+	if err != nil {
+		return nil, nil, err
+	}
 
-				return err
-			})
-			if err != nil {
-				return err
-			}
+	filters := entryFilters{searchMode}
+	if sizes := command.StringSlice("size"); len(sizes) > 0 {
+		f, err := newSizeFilter(sizes)
+		if err != nil {
+			return nil, nil, err
 		}
+		filters = append(filters, f)
+	}
+	timeFilters, err := newTimeFilters(command, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	filters = append(filters, timeFilters...)
+	ownerFilters, err := newOwnerFilters(command)
+	if err != nil {
+		return nil, nil, err
+	}
+	filters = append(filters, ownerFilters...)
+	if expr := command.String("where"); expr != "" {
+		f, err := newExprFilter(expr, roots, time.Now())
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "--where")
+		}
+		filters = append(filters, f)
+	}
 
-		for _, path := range pathList {
-			err = action.Execute(path)
-			if err != nil {
-				zap.L().Error("Action execute failed", zap.String("path", path), zap.Error(err))
-			}
+	var contains *contentFilter
+	if pattern := command.String("contains"); pattern != "" {
+		contains, err = newContentFilter(pattern, ignoreCase,
+			command.Bool("binary"), command.Bool("files-without-match"))
+		if err != nil {
+			return nil, nil, err
 		}
+		// reading contents is the most expensive check, so it goes last
+		filters = append(filters, contains)
+	}
+	return filters, contains, nil
+}
 
-		return nil
-	},
+// newFindPrinter builds the action used when no other action is given.
+func newFindPrinter(command *cli.Command, roots []string, contains *contentFilter) (Action, error) {
+	print0 := command.Bool("print0")
+	if text := command.String("template"); text != "" {
+		return newTemplateAction(os.Stdout, text, roots, print0)
+	}
+
+	format, err := newOutputFormat(command.String("format"))
+	if err != nil {
+		return nil, err
+	}
+	columns, err := newPrintColumns(command.StringSlice("columns"))
+	if err != nil {
+		return nil, err
+	}
+	printer, err := newPrintAction(os.Stdout, format, columns, print0)
+	if err != nil {
+		return nil, err
+	}
+	if contains != nil && printer.ReportsMatches() {
+		contains.matches = &sync.Map{}
+		printer.contents = contains
+	}
+	return printer, nil
 }
 
-type Action interface {
-	Execute(path string) error
+// errLimitReached stops a source once --limit matches have been found.
+var errLimitReached = errors.New("limit reached")
+
+// finder feeds every entry that passes its predicates into the action runner.
+type finder struct {
+	matcher stringMatcher
+	on      matchOn
+	exclude *exclude
+	filters entryFilters
+	ignore  ignoreOptions
+
+	maxDepth      int
+	minDepth      int
+	oneFileSystem bool
+	// prune are absolute directories never walked into, the destination of
+	// the action
+	prune []string
+
+	limit   int
+	matches int
+	sorter  *entrySorter
+	runner  *actionRunner
+
+	// actionOpts, base, plan and rowActions serve the actions named by SQL
+	// rows, base is the default action before it is planned
+	actionOpts actionOptions
+	base       Action
+	plan       *plan
+	rowActions map[string]Action
 }
 
-type DecompressAction struct{}
+// run feeds the walk roots, the path list and the SQL source, in that order,
+// into the pipeline. Empty or nil arguments disable a source.
+func (f *finder) run(roots []string, listFile string, listSep byte, src *sqlSource) error {
+	for _, root := range roots {
+		if err := f.walk(root); err != nil {
+			return err
+		}
+	}
+	if listFile != "" {
+		if err := f.listFile(listFile, listSep); err != nil {
+			return err
+		}
+	}
+	if src != nil {
+		return f.query(src)
+	}
+	return nil
+}
 
-func (d DecompressAction) Execute(path string) error {
-	if !strings.HasSuffix(path, ".gz") {
-		return nil
+// accept runs the predicates shared by the list and SQL sources on path.
+// root may be empty.
+func (f *finder) accept(root string, path string, d fs.DirEntry) (bool, error) {
+	if f.exclude.Match(root, path) || !f.matcher.Match(f.on.Subject(root, path)) {
+		return false, nil
 	}
+	return f.filters.Match(path, d)
+}
 
-	dst := strings.TrimSuffix(path, ".gz")
-	_, err := os.Stat(dst)
-	if err == nil {
-		return nil
+// emit hands a match to the sorter or straight to the runner. It reports
+// whether a directory was taken over by the action, so the walk must not
+// descend into it. A nil action runs the default one.
+func (f *finder) emit(root string, path string, d fs.DirEntry, action Action) (bool, error) {
+	if f.sorter != nil {
+		e, err := newSortedEntry(root, path, d, f.sorter.key)
+		if err != nil {
+			return false, err
+		}
+		e.action = action
+		f.sorter.Add(e)
+		// what is below a directory the action takes over goes with it
+		return f.runner.ConsumesTree(action, d.IsDir()), nil
 	}
 
-	done := false
+	consumed := f.runner.SubmitWith(path, d.IsDir(), action)
+	f.matches++
+	if f.limit > 0 && f.matches >= f.limit {
+		return consumed, errLimitReached
+	}
+	return consumed, nil
+}
 
-	f, err := os.Open(path)
-	if err != nil {
-		return err
+// flush submits the sorted matches once every source is done.
+func (f *finder) flush() {
+	if f.sorter == nil {
+		return
+	}
+	for _, e := range f.sorter.Sorted() {
+		f.runner.SubmitWith(e.path, e.isDir, e.action)
+	}
+}
+
+func (f *finder) walk(root string) error {
+	rootDev, oneFileSystem := uint64(0), f.oneFileSystem
+	if oneFileSystem {
+		var err error
+		rootDev, oneFileSystem, err = deviceOf(root)
+		if err != nil {
+			return err
+		}
 	}
-	defer func() {
-		_ = f.Close()
-		if done {
-			if trash.IsAvailable() {
-				_, _ = trash.MoveToTrash(path)
-			} else {
-				_ = os.Remove(path)
+
+	ignore := newIgnoreRules(afero.NewOsFs(), root, f.ignore)
+	return filepath.WalkDir(root, func(path string, info os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if skip, err := ignore.Skip(path, info); skip || err != nil {
+			return err
+		}
+		if info.IsDir() && f.pruned(path) {
+			// the action writes there, its output must not be found again
+			return fs.SkipDir
+		}
+		if f.exclude.Match(root, path) {
+			if info.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		// next is returned once the entry itself has been handled
+		var next error
+		depth := pathDepth(root, path)
+		if info.IsDir() {
+			if f.maxDepth >= 0 && depth >= f.maxDepth {
+				next = fs.SkipDir
+			} else if oneFileSystem && depth > 0 {
+				dev, _, err := deviceOf(path)
+				if err != nil {
+					return err
+				}
+				if dev != rootDev {
+					next = fs.SkipDir
+				}
+			}
+		}
+		if depth < f.minDepth {
+			return next
+		}
+
+		if !f.matcher.Match(f.on.Subject(root, path)) {
+			return next
+		}
+		ok, err := f.filters.Match(path, info)
+		if err != nil {
+			return err
+		}
+		if ok {
+			consumed, err := f.emit(root, path, info, nil)
+			if err != nil {
+				return err
+			}
+			if consumed {
+				// the action takes the whole tree, do not walk into it
+				return fs.SkipDir
 			}
 		}
-	}()
 
-	r, err := gzip.NewReader(f)
+		return next
+	})
+}
+
+// pruneDestination keeps the walk out of the directory action writes to.
+func (f *finder) pruneDestination(action Action) error {
+	a, ok := action.(destinationAction)
+	if !ok {
+		return nil
+	}
+	dst, err := filepath.Abs(a.Destination())
 	if err != nil {
 		return err
 	}
+	f.prune = append(f.prune, dst)
+	return nil
+}
 
-	w, err := os.Create(dst)
+// pruned reports whether the directory path is one of f.prune.
+func (f *finder) pruned(path string) bool {
+	if len(f.prune) == 0 {
+		return false
+	}
+	abs, err := filepath.Abs(path)
 	if err != nil {
-		return err
+		return false
+	}
+	return slices.Contains(f.prune, abs)
+}
+
+// pathDepth returns how many levels path is below root, root itself is 0.
+func pathDepth(root string, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
 	}
-	defer func() { _ = w.Close() }()
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
 
-	_, err = io.Copy(w, r)
+// deviceOf returns the device ID of the file system containing path. ok is
+// false on platforms that do not expose device IDs.
+func deviceOf(path string) (dev uint64, ok bool, err error) {
+	info, err := os.Lstat(path)
 	if err != nil {
-		return err
+		return 0, false, err
 	}
+	st, ok := getSysStat(info)
+	return st.Dev, ok, nil
+}
 
-	done = true
-	return nil
+// entryFilter is a predicate evaluated against every candidate entry,
+// whether it comes from the walk or from the SQL source.
+type entryFilter interface {
+	Match(path string, d fs.DirEntry) (bool, error)
 }
 
-var _ Action = &DecompressAction{}
+type entryFilters []entryFilter
+
+func (filters entryFilters) Match(path string, d fs.DirEntry) (bool, error) {
+	for _, f := range filters {
+		ok, err := f.Match(path, d)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+type Action interface {
+	Execute(path string) error
+}
 
 type OmitAction struct{}
 
@@ -245,60 +732,204 @@ func (OmitAction) Execute(path string) error {
 	return nil
 }
 
-type DeleteAction struct{}
+type DeleteAction struct {
+	journal *journal
+}
+
+var (
+	_ treeAction    = &DeleteAction{}
+	_ plannedAction = &DeleteAction{}
+)
+
+func (DeleteAction) ConsumesTree() {}
 
-func (DeleteAction) Execute(path string) error {
+func (DeleteAction) Plan(path string) (planOperation, error) {
+	return planOperation{Op: opTrash}, nil
+}
+
+func (a DeleteAction) Execute(path string) error {
 	zap.L().Info("Deleting", zap.String("path", path))
-	if trash.IsAvailable() {
-		p, err := filepath.Abs(path)
-		if err != nil {
-			return err
-		}
-		_, err = trash.MoveToTrash(p)
-		return err
-	}
-	return os.RemoveAll(path)
+	return trashOrDelete(path, a.journal)
 }
 
 type CopyAction struct {
 	dst string
+	// name replaces the file name of the source if set
+	name string
+	// roots keep the path of the source relative to its root if set
+	roots []string
+	// preserve copies mode, ownership, timestamps and xattrs too
+	preserve bool
+	reflink  reflinkMode
+	// conflict decides what happens when the destination exists, journal
+	// records the entries it overwrites
+	conflict conflictPolicy
+	journal  *journal
+	// dirs defers the metadata of the directories of a tree to Flush, nil
+	// preserves it right away
+	dirs *dirMetadata
+}
+
+var (
+	_ retargetAction = &CopyAction{}
+	_ plannedAction  = &CopyAction{}
+	_ batchAction    = &CopyAction{}
+)
+
+// Retarget places the entry exactly at dir and name, a row of the SQL
+// source naming them does not keep the path relative to the root.
+func (a CopyAction) Retarget(dir string, name string) Action {
+	a.dst = filepath.Join(a.dst, dir)
+	a.name = name
+	a.roots = nil
+	return a
 }
 
-var _ Action = &CopyAction{}
+func (a CopyAction) Destination() string {
+	return a.dst
+}
+
+func (a CopyAction) Plan(path string) (planOperation, error) {
+	o := planOperation{Op: opCopy, Dst: destinationOf(a.dst, a.name, a.roots, path), Preserve: a.preserve,
+		Reflink: a.reflink.String()}
+	if info, err := os.Lstat(path); err == nil && info.IsDir() && a.roots != nil {
+		// a tree copy only creates its directories, see Execute
+		o.Op, o.Reflink = opMkdir, ""
+		o.Preserve = a.preserve && o.Dst != filepath.Clean(a.dst)
+	}
+	return o, nil
+}
+
+// destinationOf returns where path goes in the directory dst, under name if
+// it is set. With roots, path keeps its path relative to its root, the root
+// itself becomes dst, and paths outside of every root go to dst directly.
+func destinationOf(dst string, name string, roots []string, path string) string {
+	if root := rootOf(roots, path); root != "" {
+		rel, err := filepath.Rel(root, path)
+		if err == nil {
+			return filepath.Join(dst, rel)
+		}
+	}
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	return filepath.Join(dst, name)
+}
 
 func (a CopyAction) Execute(path string) error {
-	fileName := filepath.Base(path)
-	dstPath := filepath.Join(a.dst, fileName)
+	dstPath := destinationOf(a.dst, a.name, a.roots, path)
+	fileName := filepath.Base(dstPath)
+	dstDir := filepath.Dir(dstPath)
 
-	zap.L().Info("Copy to", zap.String("file", fileName), zap.String("dst", a.dst))
-	_, err := os.Stat(dstPath)
-	if err == nil {
-		return errors.Wrapf(ErrFileExists, "path: %s", dstPath)
+	zap.L().Info("Copy to", zap.String("file", fileName), zap.String("dst", dstDir))
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() && a.roots != nil {
+		// recreate the directories of the tree, empty ones included, the
+		// destination itself keeps its own metadata
+		err = os.MkdirAll(dstPath, 0755)
+		if err != nil || !a.preserve || dstPath == filepath.Clean(a.dst) {
+			return err
+		}
+		if a.dirs != nil {
+			a.dirs.Add(path, dstPath)
+			return nil
+		}
+		return preserveMetadata(path, info, dstPath)
 	}
 
-	var r, d *os.File
-	r, err = os.Open(path)
+	dstPath, unlock, err := claimDestination(afero.NewOsFs(), a.conflict, path, dstPath, a.journal)
+	defer unlock()
+	if err != nil || dstPath == "" {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(dstPath), 0755)
 	if err != nil {
 		return err
 	}
-	defer func() { _ = r.Close() }()
 
-	d, err = os.Create(dstPath)
+	if a.preserve && info.Mode()&os.ModeSymlink != 0 {
+		var target string
+		target, err = os.Readlink(path)
+		if err == nil {
+			err = os.Symlink(target, dstPath)
+		}
+	} else {
+		err = copyFile(path, dstPath, a.reflink)
+	}
+	if err != nil || !a.preserve {
+		return err
+	}
+	return preserveMetadata(path, info, dstPath)
+}
+
+func (a *CopyAction) Flush(fail func(path string, err error)) {
+	a.dirs.Apply(fail)
+}
+
+// copyFile copies the contents of the file src to the new file dst.
+func copyFile(src string, dst string, mode reflinkMode) error {
+	r, err := os.Open(src)
 	if err != nil {
 		return err
 	}
-	defer func() { _ = d.Close() }()
+	defer func() { _ = r.Close() }()
 
-	_, err = io.Copy(d, r)
+	d, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	err = copyContents(d, r, mode)
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+	}
 	return err
 }
 
 type MoveAction struct {
 	fs  afero.Fs
 	dst string
+	// name replaces the file name of the source if set
+	name string
+	// roots keep the path of the source relative to its root if set
+	roots   []string
+	journal *journal
+	// conflict decides what happens when the destination exists
+	conflict conflictPolicy
+	// reflink applies to the copies of moves across devices
+	reflink reflinkMode
+}
+
+var (
+	_ treeAction     = &MoveAction{}
+	_ retargetAction = &MoveAction{}
+	_ plannedAction  = &MoveAction{}
+)
+
+func (MoveAction) ConsumesTree() {}
+
+// Retarget places the entry exactly at dir and name, like
+// CopyAction.Retarget.
+func (a MoveAction) Retarget(dir string, name string) Action {
+	a.dst = filepath.Join(a.dst, dir)
+	a.name = name
+	a.roots = nil
+	return a
+}
+
+func (a MoveAction) Destination() string {
+	return a.dst
 }
 
-var _ Action = &MoveAction{}
+func (a MoveAction) Plan(path string) (planOperation, error) {
+	return planOperation{Op: opMove, Dst: destinationOf(a.dst, a.name, a.roots, path),
+		Reflink: a.reflink.String()}, nil
+}
 
 func IsCrossDeviceLinkErrno(errno error) bool {
 	if runtime.GOOS == "windows" {
@@ -312,85 +943,133 @@ func IsCrossDeviceLinkErrno(errno error) bool {
 var ErrFileExists = errors.New("file exists")
 
 func (a MoveAction) Execute(path string) error {
-	fileName := filepath.Base(path)
-	dstPath := filepath.Join(a.dst, fileName)
-
-	zap.L().Info("Move to", zap.String("file", fileName), zap.String("dst", a.dst))
-	_, err := a.fs.Stat(dstPath)
-	if err == nil {
-		return errors.Wrapf(ErrFileExists, "path: %s", dstPath)
-	}
-
-	err = a.fs.Rename(path, dstPath)
-	if err != nil {
-		if IsCrossDeviceLinkErrno(err) {
-			var r, d afero.File
-			r, err = a.fs.Open(path)
-			if err != nil {
-				return err
-			}
+	dstPath := destinationOf(a.dst, a.name, a.roots, path)
+	fileName := filepath.Base(dstPath)
+	dstDir := filepath.Dir(dstPath)
 
-			d, err = a.fs.Create(dstPath)
-			if err != nil {
-				_ = r.Close()
-				return err
+	zap.L().Info("Move to", zap.String("file", fileName), zap.String("dst", dstDir))
+	if _, ok := a.fs.(*afero.OsFs); ok {
+		unlock := dstLocks.Lock(dstPath)
+		done, err := interruptedMove(path, dstPath)
+		if err == nil && done {
+			zap.L().Info("Finishing interrupted move", zap.String("path", path), zap.String("dst", dstPath))
+			err = os.RemoveAll(path)
+			if err == nil {
+				err = a.journal.Record(opMove, path, dstPath)
 			}
-
-			_, err = io.Copy(d, r)
-			_ = r.Close()
-			_ = d.Close()
-			if err != nil {
-				return err
-			}
-
-			return a.fs.Remove(path)
-		} else {
+		}
+		unlock()
+		if err != nil || done {
 			return err
 		}
 	}
-	return nil
-}
+	dstPath, unlock, err := claimDestination(a.fs, a.conflict, path, dstPath, a.journal)
+	defer unlock()
+	if err != nil || dstPath == "" {
+		return err
+	}
+	err = a.fs.MkdirAll(filepath.Dir(dstPath), 0755)
+	if err != nil {
+		return err
+	}
 
-func createDirectory(path string) {
-	_, err := os.Stat(path)
+	err = a.move(path, dstPath)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			_ = os.MkdirAll(path, 0755)
-		} else {
-			panic(err)
-		}
+		return err
+	}
+	return a.journal.Record(opMove, path, dstPath)
+}
+
+func (a MoveAction) move(path string, dstPath string) error {
+	err := a.fs.Rename(path, dstPath)
+	if err != nil && IsCrossDeviceLinkErrno(err) {
+		// only the OS file system has devices to cross
+		return moveAcrossDevices(path, dstPath, a.reflink)
 	}
+	return err
+}
+
+// actionOptions are what the actions built by newAction share.
+type actionOptions struct {
+	// printer is used when no action or the print action is given
+	printer Action
+	// journal records moves and deletes
+	journal *journal
+	// roots are what move-tree-to and copy-tree-to keep paths relative to
+	roots []string
+	// preserve keeps the metadata of copied files
+	preserve bool
+	// conflict is the policy of copies and moves for existing destinations
+	conflict conflictPolicy
+	reflink  reflinkMode
 }
 
-func newAction(action string) Action {
-	if action == "" {
-		return OmitAction{}
+// newAction parses the --action flag.
+func newAction(action string, opts actionOptions) (Action, error) {
+	if action == "" || action == "print" {
+		return opts.printer, nil
 	}
 
 	const moveToPrefix = "move-to:"
 	if strings.HasPrefix(action, moveToPrefix) {
 		dst := strings.TrimPrefix(action, moveToPrefix)
-		createDirectory(dst)
-		return MoveAction{fs: afero.NewOsFs(), dst: dst}
+		return MoveAction{fs: afero.NewOsFs(), dst: dst, journal: opts.journal, conflict: opts.conflict,
+			reflink: opts.reflink}, nil
+	}
+
+	const moveTreeToPrefix = "move-tree-to:"
+	if strings.HasPrefix(action, moveTreeToPrefix) {
+		dst := strings.TrimPrefix(action, moveTreeToPrefix)
+		return MoveAction{fs: afero.NewOsFs(), dst: dst, roots: opts.roots, journal: opts.journal,
+			conflict: opts.conflict, reflink: opts.reflink}, nil
 	}
 
 	const copyToPrefix = "copy-to:"
 	if strings.HasPrefix(action, copyToPrefix) {
 		dst := strings.TrimPrefix(action, copyToPrefix)
-		createDirectory(dst)
-		return CopyAction{dst: dst}
+		return CopyAction{dst: dst, preserve: opts.preserve, reflink: opts.reflink, conflict: opts.conflict,
+			journal: opts.journal}, nil
+	}
+
+	const copyTreeToPrefix = "copy-tree-to:"
+	if strings.HasPrefix(action, copyTreeToPrefix) {
+		dst := strings.TrimPrefix(action, copyTreeToPrefix)
+		return &CopyAction{dst: dst, roots: opts.roots, preserve: opts.preserve, reflink: opts.reflink,
+			conflict: opts.conflict, journal: opts.journal, dirs: newDirMetadata()}, nil
+	}
+
+	const execBatchPrefix = "exec-batch:"
+	if strings.HasPrefix(action, execBatchPrefix) {
+		command, err := newCommandTemplate(strings.TrimPrefix(action, execBatchPrefix))
+		if err != nil {
+			return nil, err
+		}
+		return &ExecBatchAction{command: command}, nil
+	}
+
+	const execPrefix = "exec:"
+	if strings.HasPrefix(action, execPrefix) {
+		command, err := newCommandTemplate(strings.TrimPrefix(action, execPrefix))
+		if err != nil {
+			return nil, err
+		}
+		return ExecAction{command: command}, nil
 	}
 
 	switch action {
+	case "omit":
+		return OmitAction{}, nil
 	case "rm":
 		fallthrough
 	case "delete":
-		return DeleteAction{}
+		return DeleteAction{journal: opts.journal}, nil
+	case "extract":
+		return ExtractAction{journal: opts.journal}, nil
 	case "gz":
-		return DecompressAction{}
+		return ExtractAction{journal: opts.journal, gzipOnly: true}, nil
 	}
 
-	panic(fmt.Errorf("unknown action: %s", action))
+	return nil, fmt.Errorf("unknown action: %s", action)
 }
 
 type searchType int
@@ -400,20 +1079,129 @@ const (
 	onlyDir
 	onlyEmptyDir
 	fileAndDir
+	onlyEmptyFile
+	onlySymlink
+	onlyBrokenSymlink
+	onlyExecutable
+	onlySocket
+	onlyFifo
+	onlyBlockDevice
+	onlyCharDevice
 )
 
-func newSearchType(s string) searchType {
-	if s == "file" || s == "f" {
-		return onlyFile
+var _ entryFilter = searchType(0)
+
+func (t searchType) Match(path string, d fs.DirEntry) (bool, error) {
+	mode := d.Type()
+	switch t {
+	case onlyFile:
+		return !d.IsDir(), nil
+	case onlyDir:
+		return d.IsDir(), nil
+	case onlyEmptyDir:
+		if !d.IsDir() {
+			return false, nil
+		}
+		ents, err := os.ReadDir(path)
+		if err != nil {
+			return false, err
+		}
+		return len(ents) == 0, nil
+	case onlyEmptyFile:
+		if !mode.IsRegular() {
+			return false, nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return false, err
+		}
+		return info.Size() == 0, nil
+	case onlySymlink:
+		return mode&fs.ModeSymlink != 0, nil
+	case onlyBrokenSymlink:
+		if mode&fs.ModeSymlink == 0 {
+			return false, nil
+		}
+		_, err := os.Stat(path)
+		return err != nil, nil
+	case onlyExecutable:
+		if !mode.IsRegular() {
+			return false, nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return false, err
+		}
+		return info.Mode().Perm()&0111 != 0, nil
+	case onlySocket:
+		return mode&fs.ModeSocket != 0, nil
+	case onlyFifo:
+		return mode&fs.ModeNamedPipe != 0, nil
+	case onlyBlockDevice:
+		return mode&fs.ModeDevice != 0 && mode&fs.ModeCharDevice == 0, nil
+	case onlyCharDevice:
+		return mode&fs.ModeCharDevice != 0, nil
+	default:
+		return true, nil
+	}
+}
+
+func newSearchType(s string) (searchType, error) {
+	switch s {
+	case "file", "f":
+		return onlyFile, nil
+	case "dir", "d":
+		return onlyDir, nil
+	case "empty":
+		return onlyEmptyDir, nil
+	case "empty-file":
+		return onlyEmptyFile, nil
+	case "symlink", "l":
+		return onlySymlink, nil
+	case "broken-symlink":
+		return onlyBrokenSymlink, nil
+	case "executable", "x":
+		return onlyExecutable, nil
+	case "socket", "s":
+		return onlySocket, nil
+	case "fifo", "p":
+		return onlyFifo, nil
+	case "block-device", "b":
+		return onlyBlockDevice, nil
+	case "char-device", "c":
+		return onlyCharDevice, nil
+	case "":
+		return fileAndDir, nil
 	}
-	if s == "empty" {
-		return onlyEmptyDir
+	return 0, fmt.Errorf("unknown search type: %s", s)
+}
+
+// searchTypes matches entries of any of the given types.
+type searchTypes []searchType
+
+var _ entryFilter = searchTypes{}
+
+func newSearchTypes(types []string) (searchTypes, error) {
+	result := make(searchTypes, 0, len(types))
+	for _, s := range types {
+		t, err := newSearchType(s)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, t)
 	}
-	if s == "dir" || s == "d" {
-		return onlyDir
+	return result, nil
+}
+
+func (types searchTypes) Match(path string, d fs.DirEntry) (bool, error) {
+	if len(types) == 0 {
+		return true, nil
 	}
-	if s == "" {
-		return fileAndDir
+	for _, t := range types {
+		ok, err := t.Match(path, d)
+		if err != nil || ok {
+			return ok, err
+		}
 	}
-	panic(fmt.Errorf("unknown search type: %s", s))
+	return false, nil
 }
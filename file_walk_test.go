@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WalkTestSuite struct {
+	suite.Suite
+}
+
+func TestWalk(t *testing.T) {
+	suite.Run(t, new(WalkTestSuite))
+}
+
+// visitFilter records every entry the walk hands to the filters, relative
+// to root, and accepts none.
+type visitFilter struct {
+	root    string
+	visited *[]string
+}
+
+func (v visitFilter) Match(path string, d fs.DirEntry) (bool, error) {
+	rel, err := filepath.Rel(v.root, path)
+	*v.visited = append(*v.visited, filepath.ToSlash(rel))
+	return false, err
+}
+
+// visit walks root with f and returns the visited entries, sorted.
+func (s *WalkTestSuite) visit(f *finder, root string) []string {
+	var visited []string
+	if f.matcher == nil {
+		matcher, err := compilePattern("*", false, false)
+		s.Require().NoError(err)
+		f.matcher = matcher
+	}
+	if f.exclude == nil {
+		exclude, err := newExclude(nil, false, false, matchOnPath)
+		s.Require().NoError(err)
+		f.exclude = exclude
+	}
+	f.ignore = ignoreOptions{noIgnore: true, hidden: true}
+	f.filters = entryFilters{visitFilter{root: root, visited: &visited}}
+	s.Require().NoError(f.walk(root))
+	slices.Sort(visited)
+	return visited
+}
+
+// tree creates the files names below a new directory and returns it.
+func (s *WalkTestSuite) tree(names ...string) string {
+	root := s.T().TempDir()
+	for _, name := range names {
+		path := filepath.Join(root, name)
+		s.Require().NoError(os.MkdirAll(filepath.Dir(path), 0755))
+		s.Require().NoError(os.WriteFile(path, nil, 0644))
+	}
+	return root
+}
+
+func (s *WalkTestSuite) TestExcludePruned() {
+	root := s.tree("a/1", "skip/x", "skip/deep/y", "b/skip/z", "b/2")
+	// the pattern only matches the directories, what is below them would
+	// be visited if they were walked and filtered
+	exclude, err := newExclude([]string{"skip"}, false, false, matchOnBasename)
+	s.Require().NoError(err)
+	s.Equal([]string{"a", "a/1", "b", "b/2"}, s.visit(&finder{exclude: exclude, maxDepth: -1, minDepth: 1}, root))
+}
+
+func (s *WalkTestSuite) TestDepth() {
+	root := s.tree("a/b/c/d.txt", "e.txt")
+	s.Equal([]string{".", "a", "a/b", "a/b/c", "a/b/c/d.txt", "e.txt"},
+		s.visit(&finder{maxDepth: -1}, root))
+	s.Equal([]string{".", "a", "a/b", "e.txt"}, s.visit(&finder{maxDepth: 2}, root))
+	s.Equal([]string{"a/b", "a/b/c", "a/b/c/d.txt"}, s.visit(&finder{maxDepth: -1, minDepth: 2}, root))
+	s.Equal([]string{"a/b"}, s.visit(&finder{maxDepth: 2, minDepth: 2}, root))
+}
+
+func (s *WalkTestSuite) TestOneFileSystem() {
+	// /dev/shm is a tmpfs mounted below /dev
+	dir, err := os.MkdirTemp("/dev/shm", "gofd-walk-")
+	if err != nil {
+		s.T().Skip("no tmpfs at /dev/shm")
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+	devDev, _, err := deviceOf("/dev")
+	s.Require().NoError(err)
+	shmDev, ok, err := deviceOf("/dev/shm")
+	s.Require().NoError(err)
+	if !ok || devDev == shmDev {
+		s.T().Skip("/dev/shm is not a file system of its own")
+	}
+	s.Require().NoError(os.WriteFile(filepath.Join(dir, "a"), nil, 0644))
+	rel := strings.TrimPrefix(dir, "/dev/")
+
+	visited := s.visit(&finder{maxDepth: -1}, "/dev")
+	s.Contains(visited, rel+"/a")
+
+	visited = s.visit(&finder{maxDepth: -1, oneFileSystem: true}, "/dev")
+	// the mount point itself is found, nothing below it
+	s.Contains(visited, "shm")
+	s.NotContains(visited, rel)
+	s.NotContains(visited, rel+"/a")
+}
+
+// finder returns a finder of files below the root running action.
+func (s *WalkTestSuite) finder(action Action, jobs int) *finder {
+	matcher, err := compilePattern("*", false, false)
+	s.Require().NoError(err)
+	exclude, err := newExclude(nil, false, false, matchOnPath)
+	s.Require().NoError(err)
+	f := &finder{
+		matcher:  matcher,
+		exclude:  exclude,
+		filters:  entryFilters{onlyFile},
+		maxDepth: -1,
+		runner:   newActionRunner(action, jobs),
+	}
+	s.Require().NoError(f.pruneDestination(action))
+	return f
+}
+
+func (s *WalkTestSuite) TestDestinationPruned() {
+	for _, action := range []string{"copy-to", "move-to", "copy-tree-to", "move-tree-to"} {
+		s.Run(action, func() {
+			root := filepath.Join(s.T().TempDir(), "s")
+			for i := 1; i <= 200; i++ {
+				path := filepath.Join(root, "a", fmt.Sprintf("f%d", i))
+				s.Require().NoError(os.MkdirAll(filepath.Dir(path), 0755))
+				s.Require().NoError(os.WriteFile(path, nil, 0644))
+			}
+			dst := filepath.Join(root, "z")
+			s.Require().NoError(os.Mkdir(dst, 0755))
+
+			a, err := newAction(action+":"+dst, actionOptions{roots: []string{root}})
+			s.Require().NoError(err)
+			f := s.finder(a, 4)
+			s.Require().NoError(f.walk(root))
+			s.Require().NoError(f.runner.Wait())
+			copied := 0
+			s.Require().NoError(filepath.WalkDir(dst, func(path string, d os.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					copied++
+				}
+				return err
+			}))
+			s.Equal(200, copied)
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"regexp"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"go.uber.org/zap"
+)
+
+// binaryProbeSize is how much of a file is checked for NUL bytes to decide
+// whether it is binary, like grep does.
+const binaryProbeSize = 8 * 1024
+
+// errBinaryFile is returned by search for binary input it does not look at.
+var errBinaryFile = errors.New("binary file")
+
+// contentMatch is the first match of a --contains pattern in a file.
+type contentMatch struct {
+	Line   int    `json:"line"`
+	Offset int64  `json:"offset"`
+	Text   string `json:"text"`
+}
+
+// contentFilter matches regular files whose contents match a pattern, or
+// with invert, files that do not match it. Files it cannot open and skipped
+// binary files match neither way.
+type contentFilter struct {
+	re     *regexp.Regexp
+	binary bool
+	invert bool
+
+	// matches holds the first match of every accepted path until the print
+	// action picks it up, nil if nobody asks for them.
+	matches *sync.Map
+}
+
+var _ entryFilter = &contentFilter{}
+
+func newContentFilter(pattern string, ignoreCase bool, binary bool, invert bool) (*contentFilter, error) {
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "--contains")
+	}
+	return &contentFilter{re: re, binary: binary, invert: invert}, nil
+}
+
+func (f *contentFilter) Match(path string, d fs.DirEntry) (bool, error) {
+	if !d.Type().IsRegular() {
+		return false, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		zap.L().Warn("Cannot search file", zap.String("path", path), zap.Error(err))
+		return false, nil
+	}
+	defer func() { _ = file.Close() }()
+
+	m, found, err := f.search(file)
+	if errors.Is(err, errBinaryFile) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "path: %s", path)
+	}
+	if found && f.matches != nil && !f.invert {
+		f.matches.Store(path, m)
+	}
+	return found != f.invert, nil
+}
+
+// search streams r line by line and returns the first match. Binary input
+// is skipped with errBinaryFile unless the filter was created with binary
+// set.
+func (f *contentFilter) search(r io.Reader) (contentMatch, bool, error) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	if !f.binary {
+		head, err := reader.Peek(binaryProbeSize)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+			return contentMatch{}, false, err
+		}
+		if bytes.IndexByte(head, 0) >= 0 {
+			return contentMatch{}, false, errBinaryFile
+		}
+	}
+
+	offset := int64(0)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			if loc := f.re.FindIndex(line); loc != nil {
+				return contentMatch{
+					Line:   lineNumber,
+					Offset: offset + int64(loc[0]),
+					Text:   string(bytes.TrimRight(line, "\r\n")),
+				}, true, nil
+			}
+			offset += int64(len(line))
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return contentMatch{}, false, nil
+			}
+			return contentMatch{}, false, err
+		}
+	}
+}
+
+// TakeMatch returns and forgets the recorded match of path.
+func (f *contentFilter) TakeMatch(path string) (contentMatch, bool) {
+	if f == nil || f.matches == nil {
+		return contentMatch{}, false
+	}
+	v, ok := f.matches.LoadAndDelete(path)
+	if !ok {
+		return contentMatch{}, false
+	}
+	return v.(contentMatch), true
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ContentFilterTestSuite struct {
+	suite.Suite
+}
+
+func TestContentFilter(t *testing.T) {
+	suite.Run(t, new(ContentFilterTestSuite))
+}
+
+func (s *ContentFilterTestSuite) TestSearch() {
+	f, err := newContentFilter(`token=\w+`, false, false, false)
+	s.Require().NoError(err)
+
+	m, found, err := f.search(strings.NewReader("first\r\nsecond token=abc\nthird token=def\n"))
+	s.Require().NoError(err)
+	s.True(found)
+	s.Equal(contentMatch{Line: 2, Offset: 14, Text: "second token=abc"}, m)
+
+	_, found, err = f.search(strings.NewReader("nothing here"))
+	s.Require().NoError(err)
+	s.False(found)
+
+	_, found, err = f.search(strings.NewReader("\x00token=abc"))
+	s.ErrorIs(err, errBinaryFile)
+	s.False(found)
+
+	f, err = newContentFilter(`TOKEN`, true, true, false)
+	s.Require().NoError(err)
+	m, found, err = f.search(strings.NewReader("\x00token=abc"))
+	s.Require().NoError(err)
+	s.True(found)
+	s.Equal(int64(1), m.Offset)
+}
+
+func (s *ContentFilterTestSuite) TestSkipped() {
+	dir := s.T().TempDir()
+	binary := filepath.Join(dir, "binary")
+	s.Require().NoError(os.WriteFile(binary, []byte("\x00token"), 0644))
+	missing := filepath.Join(dir, "missing")
+	s.Require().NoError(os.WriteFile(missing, []byte("other"), 0644))
+	info, err := os.Lstat(missing)
+	s.Require().NoError(err)
+	s.Require().NoError(os.Remove(missing))
+
+	for _, invert := range []bool{false, true} {
+		f, err := newContentFilter(`token`, false, false, invert)
+		s.Require().NoError(err)
+		ok, err := f.Match(binary, fs.FileInfoToDirEntry(info))
+		s.NoError(err)
+		s.False(ok)
+		ok, err = f.Match(missing, fs.FileInfoToDirEntry(info))
+		s.NoError(err)
+		s.False(ok)
+	}
+}
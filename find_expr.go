@@ -0,0 +1,515 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The --where expression language combines comparisons on entry attributes
+// with boolean operators, for example:
+//
+//	(ext in ["log", "tmp"] or name =~ "^core\.") and age > 30d and not path =~ "^/keep/"
+//
+// Attributes are name, ext, path, type (string), size (10M), depth (int),
+// mtime (date or duration ago) and age (duration since the last modification).
+
+type exprError struct {
+	expr string
+	pos  int
+	msg  string
+}
+
+func (e *exprError) Error() string {
+	return fmt.Sprintf("%s at column %d\n  %s\n  %s^", e.msg, e.pos+1, e.expr, strings.Repeat(" ", e.pos))
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+var exprOperators = []string{"==", "!=", "<=", ">=", "=~", "!~", "&&", "||", "<", ">", "=", "!"}
+
+func tokenize(expr string) ([]token, error) {
+	tokens := make([]token, 0)
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")", i})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{tokLBracket, "[", i})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{tokRBracket, "]", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokComma, ",", i})
+			i++
+		case c == '"' || c == '\'':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(expr) && rune(expr[j]) != c; j++ {
+				if expr[j] == '\\' && j+1 < len(expr) && (rune(expr[j+1]) == c || expr[j+1] == '\\') {
+					j++
+				}
+				b.WriteByte(expr[j])
+			}
+			if j >= len(expr) {
+				return nil, &exprError{expr, i, "unterminated string"}
+			}
+			tokens = append(tokens, token{tokString, b.String(), i})
+			i = j + 1
+		case unicode.IsDigit(c) || c == '.' && i+1 < len(expr) && unicode.IsDigit(rune(expr[i+1])):
+			j := i
+			for j < len(expr) && (unicode.IsLetter(rune(expr[j])) || unicode.IsDigit(rune(expr[j])) || expr[j] == '.') {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, expr[i:j], i})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(expr) && (unicode.IsLetter(rune(expr[j])) || unicode.IsDigit(rune(expr[j])) || expr[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, expr[i:j], i})
+			i = j
+		default:
+			found := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(expr[i:], op) {
+					tokens = append(tokens, token{tokOp, op, i})
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, &exprError{expr, i, fmt.Sprintf("unexpected character %q", c)}
+			}
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(expr)}), nil
+}
+
+// exprEntry is the entry an expression is evaluated against, file info is
+// only loaded when an attribute needs it.
+type exprEntry struct {
+	path  string
+	d     fs.DirEntry
+	depth int
+	now   time.Time
+	info  fs.FileInfo
+}
+
+func (e *exprEntry) Info() (fs.FileInfo, error) {
+	if e.info == nil {
+		info, err := e.d.Info()
+		if err != nil {
+			return nil, err
+		}
+		e.info = info
+	}
+	return e.info, nil
+}
+
+type predicate func(e *exprEntry) (bool, error)
+
+type attrKind int
+
+const (
+	kindString attrKind = iota
+	kindSize
+	kindInt
+	kindTime
+	kindDuration
+	kindType
+)
+
+var exprAttributes = map[string]attrKind{
+	"name":  kindString,
+	"ext":   kindString,
+	"path":  kindString,
+	"type":  kindType,
+	"size":  kindSize,
+	"depth": kindInt,
+	"mtime": kindTime,
+	"age":   kindDuration,
+}
+
+type exprParser struct {
+	expr   string
+	tokens []token
+	pos    int
+	now    time.Time
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) errorf(t token, format string, args ...any) error {
+	return &exprError{p.expr, t.pos, fmt.Sprintf(format, args...)}
+}
+
+// keyword reports whether the next token is one of the given words or
+// operators, and consumes it if so.
+func (p *exprParser) keyword(words ...string) bool {
+	t := p.peek()
+	if t.kind != tokIdent && t.kind != tokOp {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(t.text, w) {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) parseOr() (predicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or", "||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *exprEntry) (bool, error) {
+			ok, err := l(e)
+			if err != nil || ok {
+				return ok, err
+			}
+			return right(e)
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (predicate, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and", "&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(e *exprEntry) (bool, error) {
+			ok, err := l(e)
+			if err != nil || !ok {
+				return false, err
+			}
+			return right(e)
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (predicate, error) {
+	if p.keyword("not", "!") {
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e *exprEntry) (bool, error) {
+			ok, err := inner(e)
+			return !ok, err
+		}, nil
+	}
+
+	if p.peek().kind == tokLParen {
+		open := p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokRParen {
+			return nil, p.errorf(t, "expected ')' to close '(' at column %d, found %s", open.pos+1, t)
+		}
+		return inner, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (predicate, error) {
+	attr := p.next()
+	if attr.kind != tokIdent {
+		return nil, p.errorf(attr, "expected attribute, found %s", attr)
+	}
+	name := strings.ToLower(attr.text)
+	kind, ok := exprAttributes[name]
+	if !ok {
+		return nil, p.errorf(attr, "unknown attribute %s", attr)
+	}
+
+	if p.keyword("in") {
+		return p.parseIn(name, kind)
+	}
+
+	op := p.next()
+	if op.kind != tokOp || op.text == "&&" || op.text == "||" || op.text == "!" {
+		return nil, p.errorf(op, "expected comparison operator after %s, found %s", attr.text, op)
+	}
+	if op.text == "=" {
+		op.text = "=="
+	}
+	value := p.next()
+	return p.compare(name, kind, op, value)
+}
+
+func (p *exprParser) parseIn(name string, kind attrKind) (predicate, error) {
+	if t := p.next(); t.kind != tokLBracket {
+		return nil, p.errorf(t, "expected '[' after in, found %s", t)
+	}
+	preds := make([]predicate, 0)
+	eq := token{tokOp, "==", 0}
+	for {
+		value := p.next()
+		pred, err := p.compare(name, kind, eq, value)
+		if err != nil {
+			return nil, err
+		}
+		preds = append(preds, pred)
+
+		t := p.next()
+		if t.kind == tokRBracket {
+			break
+		}
+		if t.kind != tokComma {
+			return nil, p.errorf(t, "expected ',' or ']', found %s", t)
+		}
+	}
+	return func(e *exprEntry) (bool, error) {
+		for _, pred := range preds {
+			ok, err := pred(e)
+			if err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	}, nil
+}
+
+func (p *exprParser) compare(name string, kind attrKind, op token, value token) (predicate, error) {
+	if value.kind != tokString && value.kind != tokNumber && value.kind != tokIdent {
+		return nil, p.errorf(value, "expected value, found %s", value)
+	}
+
+	if op.text == "=~" || op.text == "!~" {
+		if kind != kindString && kind != kindType {
+			return nil, p.errorf(op, "%s cannot be matched with %s", name, op.text)
+		}
+		re, err := regexp.Compile(value.text)
+		if err != nil {
+			return nil, p.errorf(value, "invalid regular expression: %v", err)
+		}
+		negate := op.text == "!~"
+		return func(e *exprEntry) (bool, error) {
+			s, err := stringAttr(name, e)
+			return re.MatchString(s) != negate, err
+		}, nil
+	}
+
+	switch kind {
+	case kindString:
+		if op.text != "==" && op.text != "!=" {
+			return nil, p.errorf(op, "%s only supports ==, !=, =~, !~ and in", name)
+		}
+		want := value.text
+		if name == "ext" {
+			want = strings.TrimPrefix(want, ".")
+		}
+		negate := op.text == "!="
+		return func(e *exprEntry) (bool, error) {
+			s, err := stringAttr(name, e)
+			return (s == want) != negate, err
+		}, nil
+
+	case kindType:
+		if op.text != "==" && op.text != "!=" {
+			return nil, p.errorf(op, "type only supports ==, != and in")
+		}
+		t, err := newSearchType(value.text)
+		if err != nil || value.text == "" {
+			return nil, p.errorf(value, "unknown type %s", value)
+		}
+		negate := op.text == "!="
+		return func(e *exprEntry) (bool, error) {
+			ok, err := t.Match(e.path, e.d)
+			return ok != negate, err
+		}, nil
+
+	case kindSize:
+		want, err := parseSize(value.text)
+		if err != nil {
+			return nil, p.errorf(value, "invalid size %s", value)
+		}
+		return func(e *exprEntry) (bool, error) {
+			info, err := e.Info()
+			if err != nil {
+				return false, err
+			}
+			return compareOrdered(info.Size(), op.text, want), nil
+		}, nil
+
+	case kindInt:
+		want, err := strconv.Atoi(value.text)
+		if err != nil {
+			return nil, p.errorf(value, "invalid number %s", value)
+		}
+		return func(e *exprEntry) (bool, error) {
+			return compareOrdered(e.depth, op.text, want), nil
+		}, nil
+
+	case kindTime:
+		want, err := parseTimePoint(value.text, p.now)
+		if err != nil {
+			return nil, p.errorf(value, "invalid time %s", value)
+		}
+		return func(e *exprEntry) (bool, error) {
+			info, err := e.Info()
+			if err != nil {
+				return false, err
+			}
+			return compareOrdered(info.ModTime().UnixNano(), op.text, want.UnixNano()), nil
+		}, nil
+
+	case kindDuration:
+		want, err := parseDuration(value.text)
+		if err != nil {
+			return nil, p.errorf(value, "invalid duration %s", value)
+		}
+		return func(e *exprEntry) (bool, error) {
+			info, err := e.Info()
+			if err != nil {
+				return false, err
+			}
+			return compareOrdered(e.now.Sub(info.ModTime()), op.text, want), nil
+		}, nil
+	}
+	return nil, p.errorf(op, "unsupported attribute %s", name)
+}
+
+func stringAttr(name string, e *exprEntry) (string, error) {
+	switch name {
+	case "name":
+		return filepath.Base(e.path), nil
+	case "ext":
+		return strings.TrimPrefix(filepath.Ext(e.path), "."), nil
+	case "type":
+		for _, t := range []string{"dir", "symlink", "socket", "fifo", "block-device", "char-device"} {
+			st, _ := newSearchType(t)
+			if ok, err := st.Match(e.path, e.d); err != nil || ok {
+				return t, err
+			}
+		}
+		return "file", nil
+	default:
+		return e.path, nil
+	}
+}
+
+func compareOrdered[T int | int64 | time.Duration](a T, op string, b T) bool {
+	switch op {
+	case "==":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+// exprFilter evaluates a compiled --where expression.
+type exprFilter struct {
+	pred  predicate
+	roots []string
+	now   time.Time
+}
+
+var _ entryFilter = &exprFilter{}
+
+// newExprFilter compiles expr once, roots are used to compute depth.
+func newExprFilter(expr string, roots []string, now time.Time) (*exprFilter, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{expr: expr, tokens: tokens, now: now}
+	if p.peek().kind == tokEOF {
+		return nil, p.errorf(p.peek(), "empty expression")
+	}
+	pred, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t, "expected and, or or end of expression, found %s", t)
+	}
+	return &exprFilter{pred: pred, roots: roots, now: now}, nil
+}
+
+func (f *exprFilter) Match(path string, d fs.DirEntry) (bool, error) {
+	e := &exprEntry{path: path, d: d, now: f.now}
+	if root := rootOf(f.roots, path); root != "" {
+		e.depth = pathDepth(root, path)
+	}
+	return f.pred(e)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ExprTestSuite struct {
+	suite.Suite
+	root string
+	now  time.Time
+}
+
+func TestExpr(t *testing.T) {
+	suite.Run(t, new(ExprTestSuite))
+}
+
+func (s *ExprTestSuite) SetupTest() {
+	s.root = s.T().TempDir()
+	s.now = time.Now()
+	s.Require().NoError(os.MkdirAll(filepath.Join(s.root, "keep"), 0755))
+	s.write("app.log", 2048, 40*24*time.Hour)
+	s.write("new.tmp", 10, time.Hour)
+	s.write("keep/old.log", 10, 40*24*time.Hour)
+	s.write("main.go", 100, 40*24*time.Hour)
+}
+
+func (s *ExprTestSuite) write(name string, size int, age time.Duration) {
+	path := filepath.Join(s.root, name)
+	s.Require().NoError(os.WriteFile(path, make([]byte, size), 0644))
+	mtime := s.now.Add(-age)
+	s.Require().NoError(os.Chtimes(path, mtime, mtime))
+}
+
+func (s *ExprTestSuite) match(expr string) []string {
+	f, err := newExprFilter(expr, []string{s.root}, s.now)
+	s.Require().NoError(err, expr)
+
+	matches := make([]string, 0)
+	err = filepath.WalkDir(s.root, func(path string, d fs.DirEntry, err error) error {
+		s.Require().NoError(err)
+		ok, err := f.Match(path, d)
+		s.Require().NoError(err)
+		if ok {
+			rel, _ := filepath.Rel(s.root, path)
+			matches = append(matches, rel)
+		}
+		return nil
+	})
+	s.Require().NoError(err)
+	return matches
+}
+
+func (s *ExprTestSuite) TestEvaluate() {
+	s.Equal([]string{"app.log"},
+		s.match(`(ext == "log" or ext == "tmp") and age > 30d and not path =~ "/keep/"`))
+	s.Equal([]string{"app.log", "keep/old.log", "new.tmp"}, s.match(`ext in ["log", ".tmp"]`))
+	s.Equal([]string{"app.log"}, s.match(`size >= 2k && type == "file"`))
+	s.Equal([]string{"keep"}, s.match(`type = dir && depth == 1`))
+	s.Equal([]string{"keep/old.log"}, s.match(`depth > 1`))
+	s.Equal([]string{"new.tmp"}, s.match(`type == "f" and mtime > 1d`))
+	s.Equal([]string{"main.go"}, s.match(`name !~ "\\.(log|tmp)$" && !(type == "d")`))
+}
+
+func (s *ExprTestSuite) TestParseErrors() {
+	cases := map[string]int{
+		``:                      1,
+		`size >`:                7,
+		`(ext == "log"`:         14,
+		`ext == "log" "x"`:      14,
+		`owner == "root"`:       1,
+		`size =~ "1"`:           6,
+		`size > big`:            8,
+		`name == "unterminated`: 9,
+		`ext in ["a" "b"]`:      13,
+		`ext ~ "a"`:             5,
+	}
+	for expr, column := range cases {
+		_, err := newExprFilter(expr, nil, s.now)
+		s.Require().Error(err, expr)
+		var exprErr *exprError
+		s.Require().ErrorAs(err, &exprErr, expr)
+		s.Equal(column, exprErr.pos+1, "%s: %v", expr, err)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v3"
+)
+
+// statFilter matches on the platform specific stat fields of an entry.
+// Entries are never matched on platforms without them.
+type statFilter func(info fs.FileInfo, st sysStat) bool
+
+var _ entryFilter = statFilter(nil)
+
+func (f statFilter) Match(path string, d fs.DirEntry) (bool, error) {
+	info, err := d.Info()
+	if err != nil {
+		return false, err
+	}
+	st, ok := getSysStat(info)
+	if !ok {
+		return false, nil
+	}
+	return f(info, st), nil
+}
+
+func lookupUID(name string) (uint32, error) {
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(u.Uid, 10, 32)
+	return uint32(id), err
+}
+
+func lookupGID(name string) (uint32, error) {
+	if id, err := strconv.ParseUint(name, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseUint(g.Gid, 10, 32)
+	return uint32(id), err
+}
+
+// newOwnerFilter parses "user", "user:group" or ":group".
+func newOwnerFilter(s string) (statFilter, error) {
+	userName, groupName, _ := strings.Cut(s, ":")
+	if userName == "" && groupName == "" {
+		return nil, errors.Newf("invalid owner: %s", s)
+	}
+
+	var uid, gid uint32
+	var err error
+	if userName != "" {
+		uid, err = lookupUID(userName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if groupName != "" {
+		gid, err = lookupGID(groupName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return func(info fs.FileInfo, st sysStat) bool {
+		return (userName == "" || st.Uid == uid) && (groupName == "" || st.Gid == gid)
+	}, nil
+}
+
+var (
+	knownUsers  sync.Map
+	knownGroups sync.Map
+)
+
+func userExists(uid uint32) bool {
+	if ok, found := knownUsers.Load(uid); found {
+		return ok.(bool)
+	}
+	_, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	knownUsers.Store(uid, err == nil)
+	return err == nil
+}
+
+func groupExists(gid uint32) bool {
+	if ok, found := knownGroups.Load(gid); found {
+		return ok.(bool)
+	}
+	_, err := user.LookupGroupId(strconv.FormatUint(uint64(gid), 10))
+	knownGroups.Store(gid, err == nil)
+	return err == nil
+}
+
+// unixPerm returns the permission bits of mode as used by chmod(1),
+// including the setuid, setgid and sticky bits.
+func unixPerm(mode os.FileMode) uint32 {
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 01000
+	}
+	return perm
+}
+
+// newPermFilter parses an octal mode like find(1): "MODE" matches exactly,
+// "-MODE" requires all of the bits and "/MODE" any of them.
+func newPermFilter(s string) (statFilter, error) {
+	op := byte(0)
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "/") {
+		op = s[0]
+		s = s[1:]
+	}
+	v, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || v > 07777 {
+		return nil, errors.Newf("invalid permission: %s", s)
+	}
+	mode := uint32(v)
+
+	return func(info fs.FileInfo, st sysStat) bool {
+		perm := unixPerm(info.Mode())
+		switch op {
+		case '-':
+			return perm&mode == mode
+		case '/':
+			return mode == 0 || perm&mode != 0
+		default:
+			return perm == mode
+		}
+	}, nil
+}
+
+// newNlinkFilter parses a link count like find(1): "N" exactly, "+N" more
+// than N and "-N" less than N.
+func newNlinkFilter(s string) (statFilter, error) {
+	op := byte(0)
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		op = s[0]
+		s = s[1:]
+	}
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, errors.Newf("invalid link count: %s", s)
+	}
+
+	return func(info fs.FileInfo, st sysStat) bool {
+		switch op {
+		case '+':
+			return st.Nlink > n
+		case '-':
+			return st.Nlink < n
+		default:
+			return st.Nlink == n
+		}
+	}, nil
+}
+
+func newOwnerFilters(command *cli.Command) (entryFilters, error) {
+	filters := entryFilters{}
+	if s := command.String("owner"); s != "" {
+		f, err := newOwnerFilter(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "--owner")
+		}
+		filters = append(filters, f)
+	}
+	if command.Bool("nouser") {
+		filters = append(filters, statFilter(func(info fs.FileInfo, st sysStat) bool {
+			return !userExists(st.Uid)
+		}))
+	}
+	if command.Bool("nogroup") {
+		filters = append(filters, statFilter(func(info fs.FileInfo, st sysStat) bool {
+			return !groupExists(st.Gid)
+		}))
+	}
+	if s := command.String("perm"); s != "" {
+		f, err := newPermFilter(s)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	if s := command.String("nlink"); s != "" {
+		f, err := newNlinkFilter(s)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
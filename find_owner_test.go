@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type OwnerFilterTestSuite struct {
+	suite.Suite
+	info os.FileInfo
+}
+
+func TestOwnerFilter(t *testing.T) {
+	suite.Run(t, new(OwnerFilterTestSuite))
+}
+
+func (s *OwnerFilterTestSuite) SetupTest() {
+	path := filepath.Join(s.T().TempDir(), "file")
+	s.Require().NoError(os.WriteFile(path, nil, 0644))
+	s.Require().NoError(os.Chmod(path, 0750|os.ModeSetgid))
+	info, err := os.Lstat(path)
+	s.Require().NoError(err)
+	s.info = info
+}
+
+func (s *OwnerFilterTestSuite) TestPerm() {
+	s.Equal(uint32(02750), unixPerm(s.info.Mode()))
+
+	cases := map[string]bool{
+		"2750":  true,
+		"750":   false,
+		"-750":  true,
+		"-2000": true,
+		"-0007": false,
+		"/0055": true,
+		"/0007": false,
+		"/0":    true,
+	}
+	for input, expected := range cases {
+		f, err := newPermFilter(input)
+		s.Require().NoError(err, input)
+		s.Equal(expected, f(s.info, sysStat{}), input)
+	}
+
+	for _, input := range []string{"", "rwx", "9", "/17777"} {
+		_, err := newPermFilter(input)
+		s.Error(err, input)
+	}
+}
+
+func (s *OwnerFilterTestSuite) TestNlink() {
+	st := sysStat{Nlink: 2}
+	cases := map[string]bool{
+		"2":  true,
+		"1":  false,
+		"+1": true,
+		"+2": false,
+		"-3": true,
+		"-2": false,
+	}
+	for input, expected := range cases {
+		f, err := newNlinkFilter(input)
+		s.Require().NoError(err, input)
+		s.Equal(expected, f(s.info, st), input)
+	}
+}
+
+func (s *OwnerFilterTestSuite) TestOwner() {
+	f, err := newOwnerFilter("1000:1001")
+	s.Require().NoError(err)
+	s.True(f(s.info, sysStat{Uid: 1000, Gid: 1001}))
+	s.False(f(s.info, sysStat{Uid: 1000, Gid: 1000}))
+
+	f, err = newOwnerFilter(":1001")
+	s.Require().NoError(err)
+	s.True(f(s.info, sysStat{Uid: 0, Gid: 1001}))
+
+	_, err = newOwnerFilter(":")
+	s.Error(err)
+}
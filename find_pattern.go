@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+type stringMatcher interface {
+	Match(s string) bool
+}
+
+type regexMatcher struct {
+	*regexp.Regexp
+}
+
+func (r regexMatcher) Match(s string) bool {
+	return r.MatchString(s)
+}
+
+// foldMatcher lower-cases the subject before handing it to a matcher that was
+// compiled from a lower-cased pattern.
+type foldMatcher struct {
+	m stringMatcher
+}
+
+func (f foldMatcher) Match(s string) bool {
+	return f.m.Match(strings.ToLower(s))
+}
+
+func compilePattern(pattern string, regex bool, ignoreCase bool) (stringMatcher, error) {
+	if regex {
+		if ignoreCase {
+			pattern = "(?i)" + pattern
+		}
+		r, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return regexMatcher{r}, nil
+	}
+
+	if ignoreCase {
+		g, err := glob.Compile(strings.ToLower(pattern))
+		if err != nil {
+			return nil, err
+		}
+		return foldMatcher{g}, nil
+	}
+	return glob.Compile(pattern)
+}
+
+// matchOn selects which part of a path the patterns are matched against.
+type matchOn int
+
+const (
+	matchOnPath matchOn = iota
+	matchOnBasename
+	matchOnRelPath
+)
+
+func newMatchOn(s string) (matchOn, error) {
+	switch s {
+	case "", "path":
+		return matchOnPath, nil
+	case "basename", "name":
+		return matchOnBasename, nil
+	case "relpath":
+		return matchOnRelPath, nil
+	}
+	return 0, fmt.Errorf("unknown match target: %s", s)
+}
+
+// Subject returns the string a pattern should be matched against. root is
+// the walk root the path was found under, or empty if there is none.
+func (m matchOn) Subject(root string, path string) string {
+	switch m {
+	case matchOnBasename:
+		return filepath.Base(path)
+	case matchOnRelPath:
+		if root == "" {
+			return path
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return path
+		}
+		return rel
+	default:
+		return path
+	}
+}
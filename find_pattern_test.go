@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type PatternTestSuite struct {
+	suite.Suite
+}
+
+func TestPattern(t *testing.T) {
+	suite.Run(t, new(PatternTestSuite))
+}
+
+func (s *PatternTestSuite) TestCompilePattern() {
+	m, err := compilePattern(`\.(log|tmp)$`, true, false)
+	s.Require().NoError(err)
+	s.True(m.Match("/var/app.log"))
+	s.True(m.Match("/var/app.tmp"))
+	s.False(m.Match("/var/app.LOG"))
+
+	m, err = compilePattern(`\.(log|tmp)$`, true, true)
+	s.Require().NoError(err)
+	s.True(m.Match("/var/app.LOG"))
+
+	m, err = compilePattern("*.JPG", false, true)
+	s.Require().NoError(err)
+	s.True(m.Match("photo.jpg"))
+	s.True(m.Match("photo.Jpg"))
+
+	_, err = compilePattern("(", true, false)
+	s.Error(err)
+}
+
+func (s *PatternTestSuite) TestMatchOn() {
+	on, err := newMatchOn("basename")
+	s.Require().NoError(err)
+	s.Equal("c.txt", on.Subject("/a", "/a/b/c.txt"))
+
+	on, err = newMatchOn("relpath")
+	s.Require().NoError(err)
+	s.Equal("b/c.txt", on.Subject("/a", "/a/b/c.txt"))
+	s.Equal("/a/b/c.txt", on.Subject("", "/a/b/c.txt"))
+
+	on, err = newMatchOn("")
+	s.Require().NoError(err)
+	s.Equal("/a/b/c.txt", on.Subject("/a", "/a/b/c.txt"))
+
+	_, err = newMatchOn("dirname")
+	s.Error(err)
+}
+
+func (s *PatternTestSuite) TestExclude() {
+	e, err := newExclude([]string{`^\.git$`}, true, false, matchOnBasename)
+	s.Require().NoError(err)
+	s.True(e.Match("/repo", "/repo/.git"))
+	s.False(e.Match("/repo", "/repo/.github"))
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"io/fs"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+var sizeUnits = map[string]int64{
+	"":  1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+	"p": 1 << 50,
+}
+
+// parseSize parses a size such as "512", "4k", "10MiB" or "1.5G".
+// All units are binary, so "2G" is 2 GiB.
+func parseSize(s string) (int64, error) {
+	str := strings.ToLower(strings.TrimSpace(s))
+	i := strings.IndexFunc(str, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	num, unit := str, ""
+	if i >= 0 {
+		num, unit = str[:i], str[i:]
+	}
+	unit = strings.TrimSuffix(strings.TrimSuffix(unit, "b"), "i")
+
+	multiplier, ok := sizeUnits[unit]
+	if !ok || num == "" {
+		return 0, errors.Newf("invalid size: %s", s)
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid size: %s", s)
+	}
+	return int64(v * float64(multiplier)), nil
+}
+
+// sizeRange is an inclusive range of file sizes in bytes.
+type sizeRange struct {
+	min int64
+	max int64
+}
+
+// parseSizeRange parses a size predicate. Like find(1), "+N" matches files
+// larger than N and "-N" smaller than N. "A..B" matches A to B inclusive
+// (either end may be omitted), and a bare "N" matches exactly N.
+func parseSizeRange(s string) (sizeRange, error) {
+	r := sizeRange{min: 0, max: math.MaxInt64}
+	var err error
+	switch {
+	case strings.Contains(s, ".."):
+		lower, upper, _ := strings.Cut(s, "..")
+		if lower != "" {
+			r.min, err = parseSize(lower)
+			if err != nil {
+				return r, err
+			}
+		}
+		if upper != "" {
+			r.max, err = parseSize(upper)
+			if err != nil {
+				return r, err
+			}
+		}
+		if r.min > r.max {
+			return r, errors.Newf("invalid size range: %s", s)
+		}
+	case strings.HasPrefix(s, "+"):
+		r.min, err = parseSize(s[1:])
+		r.min++
+	case strings.HasPrefix(s, "-"):
+		r.max, err = parseSize(s[1:])
+		r.max--
+	default:
+		r.min, err = parseSize(s)
+		r.max = r.min
+	}
+	return r, err
+}
+
+func (r sizeRange) Contains(size int64) bool {
+	return size >= r.min && size <= r.max
+}
+
+// sizeFilter matches regular files whose size satisfies every range.
+type sizeFilter struct {
+	ranges []sizeRange
+}
+
+var _ entryFilter = &sizeFilter{}
+
+func newSizeFilter(exprs []string) (*sizeFilter, error) {
+	f := &sizeFilter{ranges: make([]sizeRange, 0, len(exprs))}
+	for _, expr := range exprs {
+		r, err := parseSizeRange(expr)
+		if err != nil {
+			return nil, err
+		}
+		f.ranges = append(f.ranges, r)
+	}
+	return f, nil
+}
+
+func (f *sizeFilter) Match(path string, d fs.DirEntry) (bool, error) {
+	if !d.Type().IsRegular() {
+		return false, nil
+	}
+	info, err := d.Info()
+	if err != nil {
+		return false, err
+	}
+	for _, r := range f.ranges {
+		if !r.Contains(info.Size()) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SizeFilterTestSuite struct {
+	suite.Suite
+}
+
+func TestSizeFilter(t *testing.T) {
+	suite.Run(t, new(SizeFilterTestSuite))
+}
+
+func (s *SizeFilterTestSuite) TestParseSize() {
+	cases := map[string]int64{
+		"0":    0,
+		"512":  512,
+		"512b": 512,
+		"4k":   4 << 10,
+		"4KiB": 4 << 10,
+		"10M":  10 << 20,
+		"10mb": 10 << 20,
+		"2G":   2 << 30,
+		"1.5g": 3 << 29,
+		" 1T ": 1 << 40,
+	}
+	for input, expected := range cases {
+		size, err := parseSize(input)
+		s.Require().NoError(err, input)
+		s.Equal(expected, size, input)
+	}
+
+	for _, input := range []string{"", "k", "10x", "1..2"} {
+		_, err := parseSize(input)
+		s.Error(err, input)
+	}
+}
+
+func (s *SizeFilterTestSuite) TestParseSizeRange() {
+	r, err := parseSizeRange("+2G")
+	s.Require().NoError(err)
+	s.Equal(sizeRange{min: 2<<30 + 1, max: math.MaxInt64}, r)
+
+	r, err = parseSizeRange("-4k")
+	s.Require().NoError(err)
+	s.Equal(sizeRange{min: 0, max: 4<<10 - 1}, r)
+
+	r, err = parseSizeRange("10M..100M")
+	s.Require().NoError(err)
+	s.True(r.Contains(10 << 20))
+	s.True(r.Contains(100 << 20))
+	s.False(r.Contains(100<<20 + 1))
+
+	r, err = parseSizeRange("1k..")
+	s.Require().NoError(err)
+	s.Equal(sizeRange{min: 1 << 10, max: math.MaxInt64}, r)
+
+	r, err = parseSizeRange("42")
+	s.Require().NoError(err)
+	s.Equal(sizeRange{min: 42, max: 42}, r)
+
+	_, err = parseSizeRange("100M..10M")
+	s.Error(err)
+}
+
+func (s *SizeFilterTestSuite) TestMatch() {
+	dir := s.T().TempDir()
+	sizes := map[string]int64{"small": 1<<20 - 1, "exact": 1 << 20, "large": 1<<20 + 1, "huge": 3 << 30}
+	for name, size := range sizes {
+		path := filepath.Join(dir, name)
+		s.Require().NoError(os.WriteFile(path, nil, 0644))
+		// a sparse file takes no space
+		s.Require().NoError(os.Truncate(path, size))
+	}
+	s.Require().NoError(os.Mkdir(filepath.Join(dir, "dir"), 0755))
+
+	match := func(exprs ...string) []string {
+		f, err := newSizeFilter(exprs)
+		s.Require().NoError(err)
+		var matched []string
+		for _, name := range []string{"dir", "exact", "huge", "large", "small"} {
+			info, err := os.Lstat(filepath.Join(dir, name))
+			s.Require().NoError(err)
+			ok, err := f.Match(filepath.Join(dir, name), fs.FileInfoToDirEntry(info))
+			s.Require().NoError(err)
+			if ok {
+				matched = append(matched, name)
+			}
+		}
+		return matched
+	}
+	s.Equal([]string{"huge", "large"}, match("+1M"))
+	s.Equal([]string{"small"}, match("-1M"))
+	s.Equal([]string{"exact"}, match("1M"))
+	s.Equal([]string{"exact", "large", "small"}, match("1048575..1048577"))
+	s.Equal([]string{"huge"}, match("+2G"))
+	s.Equal([]string{"large"}, match("+1M", "-2G"))
+}
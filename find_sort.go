@@ -0,0 +1,160 @@
+package main
+
+import (
+	"container/heap"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+)
+
+type sortKey int
+
+const (
+	sortNone sortKey = iota
+	sortName
+	sortSize
+	sortMtime
+	sortDepth
+	sortExt
+)
+
+func newSortKey(s string) (sortKey, error) {
+	switch s {
+	case "":
+		return sortNone, nil
+	case "name":
+		return sortName, nil
+	case "size":
+		return sortSize, nil
+	case "mtime":
+		return sortMtime, nil
+	case "depth":
+		return sortDepth, nil
+	case "ext":
+		return sortExt, nil
+	}
+	return 0, errors.Newf("unknown sort key: %s", s)
+}
+
+// sortedEntry keeps just what is needed to order a match and run its action.
+type sortedEntry struct {
+	path  string
+	isDir bool
+	size  int64
+	mtime time.Time
+	depth int
+	seq   int
+
+	// action replaces the default action if set
+	action Action
+}
+
+func newSortedEntry(root string, path string, d fs.DirEntry, key sortKey) (sortedEntry, error) {
+	e := sortedEntry{path: path, isDir: d.IsDir()}
+	switch key {
+	case sortSize, sortMtime:
+		info, err := d.Info()
+		if err != nil {
+			return e, err
+		}
+		e.size = info.Size()
+		e.mtime = info.ModTime()
+	case sortDepth:
+		e.depth = pathDepth(root, path)
+	default:
+	}
+	return e, nil
+}
+
+// entrySorter orders matches by a key. With a limit it only keeps the best
+// limit entries in a heap, so memory stays constant on huge trees.
+type entrySorter struct {
+	key     sortKey
+	reverse bool
+	limit   int
+
+	entries []sortedEntry
+	seq     int
+}
+
+func newEntrySorter(key sortKey, reverse bool, limit int) *entrySorter {
+	return &entrySorter{key: key, reverse: reverse, limit: limit}
+}
+
+func (s *entrySorter) compare(a, b *sortedEntry) int {
+	c := 0
+	switch s.key {
+	case sortName:
+		c = strings.Compare(filepath.Base(a.path), filepath.Base(b.path))
+	case sortSize:
+		c = compareInt(a.size, b.size)
+	case sortMtime:
+		c = a.mtime.Compare(b.mtime)
+	case sortDepth:
+		c = compareInt(a.depth, b.depth)
+	case sortExt:
+		c = strings.Compare(filepath.Ext(a.path), filepath.Ext(b.path))
+	default:
+	}
+	if s.reverse {
+		c = -c
+	}
+	if c == 0 {
+		c = strings.Compare(a.path, b.path)
+	}
+	if c == 0 {
+		c = compareInt(a.seq, b.seq)
+	}
+	return c
+}
+
+func compareInt[T int | int64](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// The heap keeps the worst of the retained entries on top.
+func (s *entrySorter) Len() int           { return len(s.entries) }
+func (s *entrySorter) Less(i, j int) bool { return s.compare(&s.entries[i], &s.entries[j]) > 0 }
+func (s *entrySorter) Swap(i, j int)      { s.entries[i], s.entries[j] = s.entries[j], s.entries[i] }
+func (s *entrySorter) Push(x any)         { s.entries = append(s.entries, x.(sortedEntry)) }
+func (s *entrySorter) Pop() any {
+	e := s.entries[len(s.entries)-1]
+	s.entries = s.entries[:len(s.entries)-1]
+	return e
+}
+
+func (s *entrySorter) Add(e sortedEntry) {
+	e.seq = s.seq
+	s.seq++
+
+	if s.limit <= 0 {
+		s.entries = append(s.entries, e)
+		return
+	}
+	if len(s.entries) < s.limit {
+		heap.Push(s, e)
+		return
+	}
+	if s.compare(&e, &s.entries[0]) < 0 {
+		s.entries[0] = e
+		heap.Fix(s, 0)
+	}
+}
+
+// Sorted returns the retained entries in order.
+func (s *entrySorter) Sorted() []sortedEntry {
+	sort.Slice(s.entries, func(i, j int) bool {
+		return s.compare(&s.entries[i], &s.entries[j]) < 0
+	})
+	return s.entries
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type SortTestSuite struct {
+	suite.Suite
+}
+
+func TestSort(t *testing.T) {
+	suite.Run(t, new(SortTestSuite))
+}
+
+func (s *SortTestSuite) paths(entries []sortedEntry) []string {
+	paths := make([]string, len(entries))
+	for i, e := range entries {
+		paths[i] = e.path
+	}
+	return paths
+}
+
+func (s *SortTestSuite) TestTopK() {
+	sizes := rand.Perm(1000)
+	full := newEntrySorter(sortSize, true, 0)
+	top := newEntrySorter(sortSize, true, 5)
+	for _, size := range sizes {
+		e := sortedEntry{path: string(rune('a' + size%26)), size: int64(size)}
+		full.Add(e)
+		top.Add(e)
+	}
+
+	s.Len(full.Sorted(), 1000)
+	s.Equal(full.Sorted()[:5], top.Sorted())
+	s.Equal(int64(999), top.Sorted()[0].size)
+	s.Equal(int64(995), top.Sorted()[4].size)
+}
+
+func (s *SortTestSuite) TestTreeAction() {
+	dir := s.T().TempDir()
+	src := filepath.Join(dir, "src")
+	for _, name := range []string{"d/a.txt", "d/sub/b.txt", "c.txt"} {
+		path := filepath.Join(src, name)
+		s.Require().NoError(os.MkdirAll(filepath.Dir(path), 0755))
+		s.Require().NoError(os.WriteFile(path, []byte(name), 0644))
+	}
+	matcher, err := compilePattern("*", false, false)
+	s.Require().NoError(err)
+	exclude, err := newExclude(nil, false, false, matchOnPath)
+	s.Require().NoError(err)
+
+	dst := filepath.Join(dir, "dst")
+	f := &finder{
+		matcher:  matcher,
+		exclude:  exclude,
+		maxDepth: -1,
+		minDepth: 1,
+		sorter:   newEntrySorter(sortName, false, 0),
+		runner:   newActionRunner(MoveAction{fs: afero.NewOsFs(), dst: dst}, 1),
+	}
+	s.Require().NoError(f.walk(src))
+	f.flush()
+	s.Require().NoError(f.runner.Wait())
+	s.FileExists(filepath.Join(dst, "d/sub/b.txt"))
+	s.FileExists(filepath.Join(dst, "c.txt"))
+	s.NoDirExists(filepath.Join(src, "d"))
+}
+
+func (s *SortTestSuite) TestKeys() {
+	entries := []sortedEntry{
+		{path: "/b/z.txt", depth: 2},
+		{path: "/a.go", depth: 1},
+		{path: "/c/d/e.md", depth: 3},
+	}
+
+	sorter := newEntrySorter(sortName, false, 0)
+	for _, e := range entries {
+		sorter.Add(e)
+	}
+	s.Equal([]string{"/a.go", "/c/d/e.md", "/b/z.txt"}, s.paths(sorter.Sorted()))
+
+	sorter = newEntrySorter(sortExt, false, 2)
+	for _, e := range entries {
+		sorter.Add(e)
+	}
+	s.Equal([]string{"/a.go", "/c/d/e.md"}, s.paths(sorter.Sorted()))
+
+	sorter = newEntrySorter(sortDepth, true, 0)
+	for _, e := range entries {
+		sorter.Add(e)
+	}
+	s.Equal([]string{"/c/d/e.md", "/b/z.txt", "/a.go"}, s.paths(sorter.Sorted()))
+}
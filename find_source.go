@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"go.uber.org/zap"
+)
+
+// dedupeRoots drops roots that are equal to or nested below another root, so
+// no entry is walked twice. The order of the remaining roots is kept.
+func dedupeRoots(roots []string) ([]string, error) {
+	abs := make([]string, len(roots))
+	for i, root := range roots {
+		p, err := filepath.Abs(root)
+		if err != nil {
+			return nil, err
+		}
+		abs[i] = p
+	}
+
+	result := make([]string, 0, len(roots))
+	for i, root := range roots {
+		covered := false
+		for j := range roots {
+			if i == j {
+				continue
+			}
+			if abs[i] == abs[j] {
+				// keep the first of identical roots
+				covered = j < i
+			} else {
+				covered = isInside(abs[j], abs[i])
+			}
+			if covered {
+				zap.L().Info("Root skipped, it is inside another root",
+					zap.String("root", root), zap.String("parent", roots[j]))
+				break
+			}
+		}
+		if !covered {
+			result = append(result, root)
+		}
+	}
+	return result, nil
+}
+
+// isInside reports whether path is strictly below dir, both must be clean.
+func isInside(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != "." && rel != ".." &&
+		!strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// readPathList calls fn with every path of a list separated by sep. Empty
+// entries are skipped, newline separated lists may use CRLF.
+func readPathList(r io.Reader, sep byte, fn func(path string) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString(sep)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		line = strings.TrimSuffix(line, string(sep))
+		if sep == '\n' {
+			line = strings.TrimSuffix(line, "\r")
+		}
+		if line != "" {
+			if err := fn(line); err != nil {
+				return err
+			}
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// list feeds the paths read from r into the same predicates as the walk.
+// Paths that do not exist are logged and skipped.
+func (f *finder) list(r io.Reader, sep byte) error {
+	return readPathList(r, sep, func(p string) error {
+		info, err := os.Lstat(p)
+		if err != nil {
+			zap.L().Warn("Stat failed", zap.String("path", p), zap.Error(err))
+			return nil
+		}
+		d := fs.FileInfoToDirEntry(info)
+		ok, err := f.accept("", p, d)
+		if err != nil || !ok {
+			return err
+		}
+		_, err = f.emit("", p, d, nil)
+		return err
+	})
+}
+
+// listFile reads a path list from name, "-" is stdin.
+func (f *finder) listFile(name string, sep byte) error {
+	if name == "-" {
+		return f.list(os.Stdin, sep)
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+	return f.list(file, sep)
+}
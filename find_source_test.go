@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SourceTestSuite struct {
+	suite.Suite
+}
+
+func TestSource(t *testing.T) {
+	suite.Run(t, new(SourceTestSuite))
+}
+
+func (s *SourceTestSuite) TestDedupeRoots() {
+	roots, err := dedupeRoots([]string{"a", "a/b", "c", "./a", "ab"})
+	s.NoError(err)
+	s.Equal([]string{"a", "c", "ab"}, roots)
+
+	roots, err = dedupeRoots([]string{"a/b", "."})
+	s.NoError(err)
+	s.Equal([]string{"."}, roots)
+}
+
+func (s *SourceTestSuite) read(input string, sep byte) []string {
+	var paths []string
+	err := readPathList(strings.NewReader(input), sep, func(path string) error {
+		paths = append(paths, path)
+		return nil
+	})
+	s.NoError(err)
+	return paths
+}
+
+func (s *SourceTestSuite) TestReadPathList() {
+	s.Equal([]string{"a", "b c", "d"}, s.read("a\nb c\r\n\nd", '\n'))
+	s.Equal([]string{"a\nb", "c"}, s.read("a\nb\x00c\x00", 0))
+	s.Empty(s.read("", '\n'))
+}
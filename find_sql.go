@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	_ "github.com/mattn/go-sqlite3"
+	"go.uber.org/zap"
+)
+
+// Columns of a query result that have a meaning to the SQL source, other
+// columns are ignored. Without a path column the first column is the path.
+// The destination columns are prefixed, catalogs have name columns of their
+// own.
+const (
+	sqlColumnPath   = "path"
+	sqlColumnAction = "action"
+	sqlColumnDir    = "gofd_dir"
+	sqlColumnName   = "gofd_name"
+)
+
+// sqlSource is a query whose rows are the paths to check. Each row may also
+// choose its own action and, for copy and move, its destination.
+type sqlSource struct {
+	driver    string
+	dsn       string
+	statement string
+	baseDir   string
+	params    []any
+}
+
+// parseSQLParams turns k=v pairs into named arguments of the statement.
+func parseSQLParams(params []string) ([]any, error) {
+	args := make([]any, 0, len(params))
+	for _, param := range params {
+		k, v, ok := strings.Cut(param, "=")
+		k = strings.TrimLeft(strings.TrimSpace(k), ":@$")
+		if !ok || k == "" {
+			return nil, errors.Newf("invalid parameter %q, expected name=value", param)
+		}
+		args = append(args, sql.Named(k, v))
+	}
+	return args, nil
+}
+
+// sqlRow is a row of the query result, empty fields were NULL or missing.
+type sqlRow struct {
+	path   string
+	action string
+	dir    string
+	name   string
+}
+
+// sqlRowScanner maps the columns of a result to the fields of sqlRow.
+type sqlRowScanner struct {
+	values []sql.NullString
+	dest   []any
+	index  map[string]int
+}
+
+func newSQLRowScanner(columns []string) (*sqlRowScanner, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("query returns no columns")
+	}
+	s := &sqlRowScanner{
+		values: make([]sql.NullString, len(columns)),
+		dest:   make([]any, len(columns)),
+		index:  make(map[string]int),
+	}
+	for i, column := range columns {
+		s.dest[i] = &s.values[i]
+		column = strings.ToLower(column)
+		if _, ok := s.index[column]; !ok {
+			s.index[column] = i
+		}
+	}
+	if _, ok := s.index[sqlColumnPath]; !ok {
+		s.index[sqlColumnPath] = 0
+	}
+	return s, nil
+}
+
+func (s *sqlRowScanner) field(column string) string {
+	i, ok := s.index[column]
+	if !ok {
+		return ""
+	}
+	return s.values[i].String
+}
+
+func (s *sqlRowScanner) Scan(rows *sql.Rows) (sqlRow, error) {
+	err := rows.Scan(s.dest...)
+	if err != nil {
+		return sqlRow{}, err
+	}
+	return sqlRow{
+		path:   s.field(sqlColumnPath),
+		action: s.field(sqlColumnAction),
+		dir:    s.field(sqlColumnDir),
+		name:   s.field(sqlColumnName),
+	}, nil
+}
+
+// rowAction returns the action for a row, nil for the default action.
+// Actions named by rows are created once and shared.
+func (f *finder) rowAction(row sqlRow) (Action, error) {
+	var action Action
+	if row.action != "" {
+		if f.rowActions == nil {
+			f.rowActions = make(map[string]Action)
+		}
+		var ok bool
+		action, ok = f.rowActions[row.action]
+		if !ok {
+			var err error
+			action, err = newAction(row.action, f.actionOpts)
+			if err != nil {
+				return nil, err
+			}
+			f.rowActions[row.action] = action
+		}
+	}
+	if row.dir != "" || row.name != "" {
+		if action == nil {
+			action = f.base
+		}
+		r, ok := action.(retargetAction)
+		if !ok {
+			return nil, errors.Newf("the %s and %s columns need a copy-to or move-to action",
+				sqlColumnDir, sqlColumnName)
+		}
+		if row.dir != "" && !filepath.IsLocal(row.dir) {
+			return nil, errors.Newf("%s must stay inside the destination: %s", sqlColumnDir, row.dir)
+		}
+		if row.name != "" && (!filepath.IsLocal(row.name) || strings.ContainsRune(row.name, filepath.Separator)) {
+			return nil, errors.Newf("%s must be a file name: %s", sqlColumnName, row.name)
+		}
+		action = r.Retarget(row.dir, row.name)
+	}
+	if action == nil {
+		return nil, nil
+	}
+	return newPlanAction(action, f.plan)
+}
+
+func (f *finder) query(src *sqlSource) error {
+	if !slices.Contains(sql.Drivers(), src.driver) {
+		return errors.Newf("unknown database driver: %s, available: %s",
+			src.driver, strings.Join(sql.Drivers(), ", "))
+	}
+	db, err := sql.Open(src.driver, src.dsn)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	rows, err := db.Query(src.statement, src.params...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	scanner, err := newSQLRowScanner(columns)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		row, err := scanner.Scan(rows)
+		if err != nil {
+			return err
+		}
+		if row.path == "" {
+			continue
+		}
+		p := row.path
+		if src.baseDir != "" {
+			p = filepath.Join(src.baseDir, p)
+		}
+		info, err := os.Lstat(p)
+		if err != nil {
+			zap.L().Warn("Stat failed", zap.String("path", p), zap.Error(err))
+			continue
+		}
+		d := fs.FileInfoToDirEntry(info)
+		ok, err := f.accept(src.baseDir, p, d)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		action, err := f.rowAction(row)
+		if err != nil {
+			return errors.Wrapf(err, "path: %s", p)
+		}
+		_, err = f.emit(src.baseDir, p, d, action)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type SQLSourceTestSuite struct {
+	suite.Suite
+}
+
+func TestSQLSource(t *testing.T) {
+	suite.Run(t, new(SQLSourceTestSuite))
+}
+
+func (s *SQLSourceTestSuite) TestParseParams() {
+	params, err := parseSQLParams([]string{"tag=x", ":dir=a=b", "empty="})
+	s.NoError(err)
+	s.Equal([]any{sql.Named("tag", "x"), sql.Named("dir", "a=b"), sql.Named("empty", "")}, params)
+
+	_, err = parseSQLParams([]string{"tag"})
+	s.Error(err)
+	_, err = parseSQLParams([]string{"=x"})
+	s.Error(err)
+}
+
+func (s *SQLSourceTestSuite) TestUnknownDriver() {
+	f := &finder{}
+	err := f.query(&sqlSource{driver: "nope", dsn: ":memory:", statement: "SELECT 'a.txt'"})
+	s.ErrorContains(err, "unknown database driver: nope")
+	s.ErrorContains(err, "sqlite3")
+}
+
+func (s *SQLSourceTestSuite) scan(statement string, args ...any) []sqlRow {
+	db, err := sql.Open("sqlite3", ":memory:")
+	s.Require().NoError(err)
+	defer func() { _ = db.Close() }()
+
+	rows, err := db.Query(statement, args...)
+	s.Require().NoError(err)
+	defer func() { _ = rows.Close() }()
+	columns, err := rows.Columns()
+	s.Require().NoError(err)
+	scanner, err := newSQLRowScanner(columns)
+	s.Require().NoError(err)
+
+	var result []sqlRow
+	for rows.Next() {
+		row, err := scanner.Scan(rows)
+		s.Require().NoError(err)
+		result = append(result, row)
+	}
+	s.Require().NoError(rows.Err())
+	return result
+}
+
+func (s *SQLSourceTestSuite) TestScanRows() {
+	s.Equal([]sqlRow{{path: "a.txt"}}, s.scan(`SELECT 'a.txt', 42 AS size`))
+	s.Equal([]sqlRow{{path: "b.txt", dir: "sub", name: "c.txt", action: "copy-to:out"}},
+		s.scan(`SELECT 1 AS id, 'b.txt' AS Path, 'sub' AS gofd_dir, 'c.txt' AS gofd_name, 'copy-to:out' AS action`))
+	s.Equal([]sqlRow{{path: "x"}}, s.scan(`SELECT :p AS path, NULL AS gofd_dir`, sql.Named("p", "x")))
+	s.Equal([]sqlRow{{path: "x"}}, s.scan(`SELECT 'x' AS path, 'catalog' AS name, 'dir' AS dir`))
+}
+
+func (s *SQLSourceTestSuite) TestRowAction() {
+	f := &finder{base: CopyAction{dst: "out"}}
+	action, err := f.rowAction(sqlRow{path: "a.txt", dir: "sub", name: "b.txt"})
+	s.Require().NoError(err)
+	o, err := action.(CopyAction).Plan("a.txt")
+	s.Require().NoError(err)
+	s.Equal("out/sub/b.txt", o.Dst)
+
+	for _, row := range []sqlRow{
+		{path: "a.txt", dir: "../x"},
+		{path: "a.txt", dir: "/tmp"},
+		{path: "a.txt", name: ".."},
+		{path: "a.txt", name: "x/y"},
+	} {
+		_, err = f.rowAction(row)
+		s.Error(err, row)
+	}
+}
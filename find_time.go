@@ -0,0 +1,171 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v3"
+)
+
+var durationUnits = map[string]time.Duration{
+	"s":   time.Second,
+	"sec": time.Second,
+	"m":   time.Minute,
+	"min": time.Minute,
+	"h":   time.Hour,
+	"d":   24 * time.Hour,
+	"w":   7 * 24 * time.Hour,
+}
+
+// parseDuration extends time.ParseDuration with days and weeks, e.g. "7d",
+// "2w" or "1d12h".
+func parseDuration(s string) (time.Duration, error) {
+	str := strings.ToLower(strings.TrimSpace(s))
+	if str == "" {
+		return 0, errors.New("empty duration")
+	}
+
+	var d time.Duration
+	for str != "" {
+		i := strings.IndexFunc(str, func(r rune) bool {
+			return (r < '0' || r > '9') && r != '.'
+		})
+		if i <= 0 {
+			return 0, errors.Newf("invalid duration: %s", s)
+		}
+		num := str[:i]
+		str = str[i:]
+
+		j := strings.IndexFunc(str, func(r rune) bool {
+			return (r >= '0' && r <= '9') || r == '.'
+		})
+		if j < 0 {
+			j = len(str)
+		}
+		unit, ok := durationUnits[str[:j]]
+		if !ok {
+			return 0, errors.Newf("invalid duration unit: %s", s)
+		}
+		str = str[j:]
+
+		v, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "invalid duration: %s", s)
+		}
+		d += time.Duration(v * float64(unit))
+	}
+	return d, nil
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTimePoint parses either an absolute date or a duration relative to now.
+func parseTimePoint(s string, now time.Time) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		t, err := time.ParseInLocation(layout, strings.TrimSpace(s), time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+	d, err := parseDuration(s)
+	if err != nil {
+		return time.Time{}, errors.Newf("invalid time or duration: %s", s)
+	}
+	return now.Add(-d), nil
+}
+
+type timeField int
+
+const (
+	modifyTime timeField = iota
+	accessTime
+)
+
+func (f timeField) Of(info fs.FileInfo) time.Time {
+	if f == accessTime {
+		if st, ok := getSysStat(info); ok {
+			return st.Atime
+		}
+	}
+	return info.ModTime()
+}
+
+// timeFilter matches entries whose timestamp is after a fixed point, or with
+// before set at or before it, so the two never both match an entry.
+type timeFilter struct {
+	field     timeField
+	threshold time.Time
+	before    bool
+}
+
+var _ entryFilter = &timeFilter{}
+
+func newTimeFilter(field timeField, s string, before bool, now time.Time) (*timeFilter, error) {
+	t, err := parseTimePoint(s, now)
+	if err != nil {
+		return nil, err
+	}
+	return &timeFilter{field: field, threshold: t, before: before}, nil
+}
+
+// newNewerFilter matches entries modified after the reference file.
+func newNewerFilter(reference string) (*timeFilter, error) {
+	info, err := os.Stat(reference)
+	if err != nil {
+		return nil, err
+	}
+	return &timeFilter{field: modifyTime, threshold: info.ModTime()}, nil
+}
+
+func (f *timeFilter) Match(path string, d fs.DirEntry) (bool, error) {
+	info, err := d.Info()
+	if err != nil {
+		return false, err
+	}
+	t := f.field.Of(info)
+	if f.before {
+		return !t.After(f.threshold), nil
+	}
+	return t.After(f.threshold), nil
+}
+
+func newTimeFilters(command *cli.Command, now time.Time) (entryFilters, error) {
+	filters := entryFilters{}
+	for _, opt := range []struct {
+		flag   string
+		field  timeField
+		before bool
+	}{
+		{"changed-within", modifyTime, false},
+		{"changed-before", modifyTime, true},
+		{"accessed-before", accessTime, true},
+	} {
+		s := command.String(opt.flag)
+		if s == "" {
+			continue
+		}
+		f, err := newTimeFilter(opt.field, s, opt.before, now)
+		if err != nil {
+			return nil, errors.Wrapf(err, "--%s", opt.flag)
+		}
+		filters = append(filters, f)
+	}
+
+	if reference := command.String("newer"); reference != "" {
+		f, err := newNewerFilter(reference)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TimeFilterTestSuite struct {
+	suite.Suite
+}
+
+func TestTimeFilter(t *testing.T) {
+	suite.Run(t, new(TimeFilterTestSuite))
+}
+
+func (s *TimeFilterTestSuite) TestParseDuration() {
+	cases := map[string]time.Duration{
+		"30s":   30 * time.Second,
+		"15min": 15 * time.Minute,
+		"12h":   12 * time.Hour,
+		"7d":    7 * 24 * time.Hour,
+		"2w":    14 * 24 * time.Hour,
+		"1d12h": 36 * time.Hour,
+		"1.5h":  90 * time.Minute,
+	}
+	for input, expected := range cases {
+		d, err := parseDuration(input)
+		s.Require().NoError(err, input)
+		s.Equal(expected, d, input)
+	}
+
+	for _, input := range []string{"", "d", "7", "7y", "h7"} {
+		_, err := parseDuration(input)
+		s.Error(err, input)
+	}
+}
+
+func (s *TimeFilterTestSuite) TestParseTimePoint() {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.Local)
+
+	t, err := parseTimePoint("7d", now)
+	s.Require().NoError(err)
+	s.Equal(time.Date(2024, 6, 8, 12, 0, 0, 0, time.Local), t)
+
+	t, err = parseTimePoint("2024-01-02", now)
+	s.Require().NoError(err)
+	s.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local), t)
+
+	t, err = parseTimePoint("2024-01-02 03:04:05", now)
+	s.Require().NoError(err)
+	s.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local), t)
+
+	_, err = parseTimePoint("yesterday", now)
+	s.Error(err)
+}
+
+func (s *TimeFilterTestSuite) TestMatch() {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.Local)
+	dir := s.T().TempDir()
+	times := map[string]time.Time{
+		"old":      now.Add(-30 * 24 * time.Hour),
+		"boundary": now.Add(-7 * 24 * time.Hour),
+		"recent":   now.Add(-time.Hour),
+	}
+	for name, t := range times {
+		path := filepath.Join(dir, name)
+		s.Require().NoError(os.WriteFile(path, nil, 0644))
+		s.Require().NoError(os.Chtimes(path, t, t))
+	}
+
+	match := func(f *timeFilter) []string {
+		var matched []string
+		for _, name := range []string{"boundary", "old", "recent"} {
+			info, err := os.Lstat(filepath.Join(dir, name))
+			s.Require().NoError(err)
+			ok, err := f.Match(filepath.Join(dir, name), fs.FileInfoToDirEntry(info))
+			s.Require().NoError(err)
+			if ok {
+				matched = append(matched, name)
+			}
+		}
+		return matched
+	}
+	filter := func(field timeField, expr string, before bool) *timeFilter {
+		f, err := newTimeFilter(field, expr, before, now)
+		s.Require().NoError(err)
+		return f
+	}
+
+	// an entry exactly at the point is before it, not within
+	s.Equal([]string{"recent"}, match(filter(modifyTime, "7d", false)))
+	s.Equal([]string{"boundary", "old"}, match(filter(modifyTime, "7d", true)))
+	s.Equal([]string{"boundary", "recent"}, match(filter(modifyTime, "2024-06-01", false)))
+	s.Equal([]string{"old"}, match(filter(accessTime, "2024-06-01", true)))
+
+	newer, err := newNewerFilter(filepath.Join(dir, "boundary"))
+	s.Require().NoError(err)
+	s.Equal([]string{"recent"}, match(newer))
+}
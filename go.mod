@@ -8,6 +8,7 @@ require (
 	github.com/cockroachdb/pebble v1.1.5
 	github.com/gobwas/glob v0.2.3
 	github.com/jotfs/fastcdc-go v0.2.0
+	github.com/klauspost/compress v1.18.0
 	github.com/laurent22/go-trash v0.0.0-20250304161307-725f51160fe4
 	github.com/mattn/go-sqlite3 v1.14.28
 	github.com/negrel/assert v0.5.0
@@ -17,8 +18,10 @@ require (
 	github.com/spf13/afero v1.14.0
 	github.com/stretchr/testify v1.10.0
 	github.com/syndtr/goleveldb v1.0.0
+	github.com/ulikunitz/xz v0.5.17
 	github.com/urfave/cli/v3 v3.3.3
 	go.uber.org/zap v1.27.0
+	golang.org/x/sys v0.33.0
 	google.golang.org/protobuf v1.36.6
 )
 
@@ -35,7 +38,6 @@ require (
 	github.com/getsentry/sentry-go v0.33.0 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/golang/snappy v1.0.0 // indirect
-	github.com/klauspost/compress v1.18.0 // indirect
 	github.com/kr/pretty v0.3.1 // indirect
 	github.com/kr/text v0.2.0 // indirect
 	github.com/mattn/go-colorable v0.1.14 // indirect
@@ -55,7 +57,6 @@ require (
 	github.com/rogpeppe/go-internal v1.14.1 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	golang.org/x/exp v0.0.0-20250606033433-dcc06ee1d476 // indirect
-	golang.org/x/sys v0.33.0 // indirect
 	golang.org/x/term v0.32.0 // indirect
 	golang.org/x/text v0.26.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
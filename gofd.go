@@ -14,6 +14,13 @@ import (
 var cmd = &cli.Command{
 	Name:  "gofd",
 	Usage: "fd in go",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "delete-permanently",
+			Usage:       "delete paths that cannot be moved to a trash, instead of failing",
+			Destination: &deletePermanently,
+		},
+	},
 	Commands: []*cli.Command{
 		cmdFind,
 		cmdDeduplicate,
@@ -21,6 +28,11 @@ var cmd = &cli.Command{
 		cmdStat,
 		cmdMerge,
 		cmdHash,
+		cmdIndex,
+		cmdVolume,
+		cmdUndo,
+		cmdApply,
+		cmdTrash,
 	},
 }
 
@@ -79,5 +91,7 @@ func main() {
 	err = cmd.Run(context.Background(), os.Args)
 	if err != nil {
 		zap.L().Error("Unexpected error", zap.Error(err))
+		_ = logger.Sync()
+		os.Exit(1)
 	}
 }
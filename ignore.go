@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v3"
+)
+
+// ignoreFileNames are read from every directory, later files take precedence.
+var ignoreFileNames = []string{".gitignore", ".ignore", ".gofdignore"}
+
+// ignorePattern is a single line of an ignore file, compiled with gitignore
+// semantics and matched against paths relative to the file's directory.
+type ignorePattern struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+func compileIgnorePattern(line string) (ignorePattern, bool) {
+	line = strings.TrimRight(line, "\r")
+	if !strings.HasSuffix(line, `\ `) {
+		line = strings.TrimRight(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignorePattern{}, false
+	}
+
+	var p ignorePattern
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return ignorePattern{}, false
+	}
+
+	// a slash anywhere but at the end anchors the pattern to its directory
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	if !anchored {
+		b.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch c {
+		case '*':
+			if i+1 < len(line) && line[i+1] == '*' {
+				atStart := i == 0 || line[i-1] == '/'
+				switch {
+				case atStart && i+2 < len(line) && line[i+2] == '/':
+					b.WriteString("(?:.*/)?")
+					i += 2
+				case atStart && i+2 == len(line):
+					b.WriteString(".*")
+					i++
+				default:
+					b.WriteString("[^/]*")
+					i++
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			j := strings.IndexByte(line[i+1:], ']')
+			if j < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := line[i+1 : i+1+j]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += j + 1
+		case '\\':
+			if i+1 < len(line) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(line[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return ignorePattern{}, false
+	}
+	p.re = re
+	return p, true
+}
+
+func parseIgnoreFile(fs afero.Fs, path string) ([]ignorePattern, error) {
+	f, err := fs.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	patterns := make([]ignorePattern, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if p, ok := compileIgnorePattern(scanner.Text()); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns, scanner.Err()
+}
+
+type ignoreOptions struct {
+	noIgnore bool
+	hidden   bool
+}
+
+func newIgnoreOptions(command *cli.Command) ignoreOptions {
+	return ignoreOptions{
+		noIgnore: command.Bool("no-ignore"),
+		hidden:   command.Bool("hidden"),
+	}
+}
+
+// ignoreFlags are shared by every command that walks a tree.
+func ignoreFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "no-ignore",
+			Aliases: []string{"I"},
+			Usage:   "do not respect .gitignore, .ignore and .gofdignore files",
+		},
+		&cli.BoolFlag{
+			Name:    "hidden",
+			Aliases: []string{"H"},
+			Usage:   "include hidden files and directories",
+		},
+	}
+}
+
+// respectIgnoreFlag is for commands that see every file unless asked to
+// skip what find skips.
+func respectIgnoreFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:  "respect-ignore",
+		Usage: "respect .gitignore, .ignore and .gofdignore files and skip hidden files and directories",
+	}
+}
+
+func newRespectIgnoreOptions(command *cli.Command) ignoreOptions {
+	respect := command.Bool("respect-ignore")
+	return ignoreOptions{noIgnore: !respect, hidden: !respect}
+}
+
+// ignoreRules decides whether a path below root is ignored. Ignore files are
+// loaded lazily per directory, so it works with any walk order and is safe
+// for concurrent use by parallel walkers.
+type ignoreRules struct {
+	fs   afero.Fs
+	root string
+	opts ignoreOptions
+
+	mu       sync.Mutex
+	patterns map[string][]ignorePattern
+	ignored  map[string]bool
+}
+
+func newIgnoreRules(fs afero.Fs, root string, opts ignoreOptions) *ignoreRules {
+	return &ignoreRules{
+		fs:       fs,
+		root:     filepath.Clean(root),
+		opts:     opts,
+		patterns: make(map[string][]ignorePattern),
+		ignored:  make(map[string]bool),
+	}
+}
+
+func (r *ignoreRules) Enabled() bool {
+	return !r.opts.noIgnore || !r.opts.hidden
+}
+
+// Ignored reports whether path, or any directory between root and path, is
+// hidden or matched by an ignore file.
+func (r *ignoreRules) Ignored(path string, isDir bool) (bool, error) {
+	path = filepath.Clean(path)
+	if !r.Enabled() || path == r.root {
+		return false, nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if parent := filepath.Dir(path); r.below(parent) {
+		ok, err := r.dirIgnored(parent)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return r.match(path, isDir)
+}
+
+func (r *ignoreRules) dirIgnored(dir string) (bool, error) {
+	if ok, found := r.ignored[dir]; found {
+		return ok, nil
+	}
+
+	ok := false
+	var err error
+	if parent := filepath.Dir(dir); r.below(parent) {
+		ok, err = r.dirIgnored(parent)
+		if err != nil {
+			return false, err
+		}
+	}
+	if !ok {
+		ok, err = r.match(dir, true)
+		if err != nil {
+			return false, err
+		}
+	}
+	r.ignored[dir] = ok
+	return ok, nil
+}
+
+// below reports whether dir is strictly inside the root.
+func (r *ignoreRules) below(dir string) bool {
+	if dir == r.root {
+		return false
+	}
+	if r.root == "." {
+		return !filepath.IsAbs(dir) && dir != ".." &&
+			!strings.HasPrefix(dir, ".."+string(filepath.Separator))
+	}
+	prefix := r.root
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+	return strings.HasPrefix(dir, prefix)
+}
+
+// match checks path against the ignore files of its ancestors, the nearest
+// directory and the last matching pattern win.
+func (r *ignoreRules) match(path string, isDir bool) (bool, error) {
+	if !r.opts.hidden && strings.HasPrefix(filepath.Base(path), ".") {
+		return true, nil
+	}
+	if r.opts.noIgnore {
+		return false, nil
+	}
+
+	dirs := make([]string, 0)
+	for dir := filepath.Dir(path); dir == r.root || r.below(dir); dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == r.root {
+			break
+		}
+	}
+
+	for _, dir := range dirs {
+		patterns, err := r.load(dir)
+		if err != nil {
+			return false, err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return false, err
+		}
+		rel = filepath.ToSlash(rel)
+		for i := len(patterns) - 1; i >= 0; i-- {
+			p := patterns[i]
+			if p.dirOnly && !isDir {
+				continue
+			}
+			if p.re.MatchString(rel) {
+				return !p.negate, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (r *ignoreRules) load(dir string) ([]ignorePattern, error) {
+	if patterns, ok := r.patterns[dir]; ok {
+		return patterns, nil
+	}
+	patterns := make([]ignorePattern, 0)
+	for _, name := range ignoreFileNames {
+		p, err := parseIgnoreFile(r.fs, filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p...)
+	}
+	r.patterns[dir] = patterns
+	return patterns, nil
+}
+
+// Skip is meant to be called first in a WalkDir callback. It returns
+// fs.SkipDir for ignored directories, so the walk does not descend into them.
+func (r *ignoreRules) Skip(path string, d fs.DirEntry) (bool, error) {
+	ignored, err := r.Ignored(path, d.IsDir())
+	if err != nil || !ignored {
+		return false, err
+	}
+	if d.IsDir() {
+		return true, fs.SkipDir
+	}
+	return true, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type IgnoreTestSuite struct {
+	suite.Suite
+}
+
+func TestIgnore(t *testing.T) {
+	suite.Run(t, new(IgnoreTestSuite))
+}
+
+func (s *IgnoreTestSuite) TestCompileIgnorePattern() {
+	cases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*.log", "app.log", true},
+		{"*.log", "a/b/app.log", true},
+		{"*.log", "app.log.1", false},
+		{"/build", "build", true},
+		{"/build", "a/build", false},
+		{"doc/*.txt", "doc/a.txt", true},
+		{"doc/*.txt", "doc/x/a.txt", false},
+		{"doc/**/*.txt", "doc/x/y/a.txt", true},
+		{"doc/**/*.txt", "doc/a.txt", true},
+		{"**/cache", "a/b/cache", true},
+		{"out/**", "out/a/b", true},
+		{"file[0-9].txt", "file7.txt", true},
+		{"file[!0-9].txt", "file7.txt", false},
+		{`\#notes`, "#notes", true},
+	}
+	for _, c := range cases {
+		p, ok := compileIgnorePattern(c.pattern)
+		s.Require().True(ok, c.pattern)
+		s.Equal(c.match, p.re.MatchString(c.path), "%s ~ %s", c.pattern, c.path)
+	}
+
+	for _, line := range []string{"", "   ", "# comment", "!", "/"} {
+		_, ok := compileIgnorePattern(line)
+		s.False(ok, line)
+	}
+
+	p, _ := compileIgnorePattern("!keep/")
+	s.True(p.negate)
+	s.True(p.dirOnly)
+}
+
+func (s *IgnoreTestSuite) TestIgnoreRules() {
+	fs := afero.NewMemMapFs()
+	s.Require().NoError(afero.WriteFile(fs, "/repo/.gitignore",
+		[]byte("*.log\n!keep.log\nbuild/\n/tmp\n"), 0644))
+	s.Require().NoError(afero.WriteFile(fs, "/repo/sub/.gofdignore",
+		[]byte("!debug.log\n"), 0644))
+
+	rules := newIgnoreRules(fs, "/repo", ignoreOptions{})
+	cases := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"/repo/main.go", false, false},
+		{"/repo/app.log", false, true},
+		{"/repo/keep.log", false, false},
+		{"/repo/sub/app.log", false, true},
+		{"/repo/sub/debug.log", false, false},
+		{"/repo/build", true, true},
+		{"/repo/build/out.bin", false, true},
+		{"/repo/sub/build", false, false},
+		{"/repo/tmp", true, true},
+		{"/repo/sub/tmp", true, false},
+		{"/repo/.git", true, true},
+		{"/repo/.git/config", false, true},
+	}
+	for _, c := range cases {
+		ignored, err := rules.Ignored(c.path, c.isDir)
+		s.Require().NoError(err)
+		s.Equal(c.ignored, ignored, c.path)
+	}
+
+	rules = newIgnoreRules(fs, "/repo", ignoreOptions{noIgnore: true, hidden: true})
+	for _, c := range cases {
+		ignored, err := rules.Ignored(c.path, c.isDir)
+		s.Require().NoError(err)
+		s.False(ignored, c.path)
+	}
+
+	rules = newIgnoreRules(fs, "/repo", ignoreOptions{hidden: true})
+	ignored, err := rules.Ignored("/repo/.git/config", false)
+	s.Require().NoError(err)
+	s.False(ignored)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v3"
+)
+
+type journalOp string
+
+const (
+	// opMove moved Src to Dst.
+	opMove journalOp = "move"
+	// opTrash moved Src to Trash.
+	opTrash journalOp = "trash"
+	// opDelete deleted Src for good, it cannot be undone.
+	opDelete journalOp = "delete"
+	// opRemoveDuplicate deleted Src because Dst has the same contents.
+	opRemoveDuplicate journalOp = "remove-duplicate"
+	// opCopy copied Src to Dst, it is only planned, never journaled.
+	opCopy journalOp = "copy"
+	// opMkdir created Dst for the directory Src of a tree copy, it is only
+	// planned, never journaled.
+	opMkdir journalOp = "mkdir"
+	// opExtract extracted the archive Src to Dst and trashed it, it is only
+	// planned, the journal has the trash of Src.
+	opExtract journalOp = "extract"
+)
+
+// journalRecord is a line of the journal. Size, IsDir and XXHash describe
+// the entry at the time of the operation, so undo can tell whether it
+// changed since.
+type journalRecord struct {
+	Time   time.Time `json:"time"`
+	Op     journalOp `json:"op"`
+	Src    string    `json:"src"`
+	Dst    string    `json:"dst,omitempty"`
+	Trash  string    `json:"trash,omitempty"`
+	IsDir  bool      `json:"is_dir,omitempty"`
+	Size   int64     `json:"size"`
+	XXHash string    `json:"xxhash,omitempty"`
+}
+
+// journal is an append-only JSON lines log of the operations that change
+// the file system. A nil journal records nothing, its methods are safe for
+// concurrent use.
+type journal struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func journalFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "journal",
+		Usage: "append every move and delete to this file, so gofd undo can reverse them",
+	}
+}
+
+// openJournal opens path for appending, or returns nil if path is empty.
+func openJournal(path string) (*journal, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &journal{f: f}, nil
+}
+
+func (j *journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	return j.f.Close()
+}
+
+// Describe returns a record of op with the metadata of the entry at path.
+func (j *journal) Describe(op journalOp, src string, dst string, path string) (journalRecord, error) {
+	if j == nil {
+		return journalRecord{}, nil
+	}
+	rec := journalRecord{Op: op}
+	var err error
+	rec.Src, err = filepath.Abs(src)
+	if err != nil {
+		return rec, err
+	}
+	if dst != "" {
+		dst, err = filepath.Abs(dst)
+		if err != nil {
+			return rec, err
+		}
+	}
+	if op == opTrash {
+		rec.Trash = dst
+	} else {
+		rec.Dst = dst
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return rec, err
+	}
+	rec.IsDir = info.IsDir()
+	rec.Size = info.Size()
+	if info.Mode().IsRegular() {
+		h, err := xxHashFile(path)
+		if err != nil {
+			return rec, err
+		}
+		rec.XXHash = fmt.Sprintf("0x%x", h)
+	}
+	return rec, nil
+}
+
+// Append writes rec and syncs it to disk.
+func (j *journal) Append(rec journalRecord) error {
+	if j == nil {
+		return nil
+	}
+	rec.Time = time.Now()
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.f.Write(append(b, '\n'))
+	if err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+// Record appends op once it is done, the entry is now at dst.
+func (j *journal) Record(op journalOp, src string, dst string) error {
+	if j == nil {
+		return nil
+	}
+	rec, err := j.Describe(op, src, dst, dst)
+	if err != nil {
+		return errors.Wrap(err, "journal")
+	}
+	return j.Append(rec)
+}
+
+// readJournal returns every record of a journal in order.
+func readJournal(r io.Reader) ([]journalRecord, error) {
+	var records []journalRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec journalRecord
+		err := json.Unmarshal(scanner.Bytes(), &rec)
+		if err != nil {
+			return nil, errors.Wrapf(err, "line %d", line)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	iofs "io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -24,11 +25,26 @@ func checkPath(p string) (s string, err error) {
 	return
 }
 
-func mergePath(fs afero.Fs, dstPath string, srcPath string, dryRun bool) error {
+// mergeOptions are the settings of mergePath. With a plan, the moves are
+// added to it instead of being done. Files identical to their destination
+// are removed, conflict decides about the others.
+type mergeOptions struct {
+	dryRun   bool
+	ignore   ignoreOptions
+	journal  *journal
+	plan     *plan
+	conflict conflictPolicy
+}
+
+func mergePath(fs afero.Fs, dstPath string, srcPath string, opts mergeOptions) error {
+	ignore := newIgnoreRules(fs, srcPath, opts.ignore)
 	return afero.Walk(fs, srcPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if skip, err := ignore.Skip(path, iofs.FileInfoToDirEntry(info)); skip || err != nil {
+			return err
+		}
 		if info.IsDir() {
 			return nil
 		}
@@ -37,38 +53,62 @@ func mergePath(fs afero.Fs, dstPath string, srcPath string, dryRun bool) error {
 		fileDir := filepath.Dir(path)
 		dstDir := filepath.Join(dstPath, strings.TrimPrefix(fileDir, srcPath))
 
-		if dryRun {
+		if opts.dryRun {
 			fmt.Println(fmt.Sprintf("[Dry run] Move file %s from %s to %s", fileName, fileDir, dstDir))
 			return nil
 		}
-
-		_, err = fs.Stat(dstDir)
-		if err != nil {
-			if !os.IsNotExist(err) {
-				return err
-			}
-			err = fs.MkdirAll(dstDir, 0755)
+		if opts.plan != nil {
+			return planMerge(fs, path, filepath.Join(dstDir, fileName), opts.plan)
 		}
 
-		action := MoveAction{fs: fs, dst: dstDir}
-		err = action.Execute(path)
-		if err != nil {
-			if !errors.Is(err, ErrFileExists) {
+		dstFile := filepath.Join(dstDir, fileName)
+		_, err = fs.Stat(dstFile)
+		if err == nil {
+			ok, err := fileHashEqual(path, dstFile)
+			if err != nil {
 				return err
 			}
-			var ok bool
-			ok, err = fileHashEqual(path, filepath.Join(dstDir, fileName))
 			if ok {
-				return os.Remove(path)
-			} else {
-				zap.L().Info("Files are not the same", zap.String("file", fileName),
-					zap.String("src", fileDir), zap.String("dst", dstDir))
+				return removeDuplicate(path, dstFile, opts.journal)
 			}
 		}
-		return nil
+
+		action := MoveAction{fs: fs, dst: dstDir, journal: opts.journal, conflict: opts.conflict}
+		return action.Execute(path)
 	})
 }
 
+// planMerge plans moving path to dstFile, or removing it if dstFile already
+// has the same contents.
+func planMerge(fs afero.Fs, path string, dstFile string, p *plan) error {
+	_, err := fs.Stat(dstFile)
+	if err != nil {
+		return p.Add(opMove, path, dstFile)
+	}
+	ok, err := fileHashEqual(path, dstFile)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		zap.L().Info("Files are not the same", zap.String("src", path), zap.String("dst", dstFile))
+		return nil
+	}
+	return p.Add(opRemoveDuplicate, path, dstFile)
+}
+
+// removeDuplicate removes path, which has the same contents as dup.
+func removeDuplicate(path string, dup string, journal *journal) error {
+	rec, err := journal.Describe(opRemoveDuplicate, path, dup, path)
+	if err != nil {
+		return errors.Wrap(err, "journal")
+	}
+	err = os.Remove(path)
+	if err != nil {
+		return err
+	}
+	return journal.Append(rec)
+}
+
 func fileHashEqual(path1, path2 string) (ok bool, err error) {
 	hash1, err := xxHashFile(path1)
 	if err != nil {
@@ -90,6 +130,10 @@ var cmdMerge = &cli.Command{
 	},
 	Flags: []cli.Flag{
 		&cli.BoolFlag{Name: "execute", Aliases: []string{"x"}},
+		conflictFlag("skip"),
+		journalFlag(),
+		planFlag(),
+		respectIgnoreFlag(),
 	},
 	Action: func(ctx context.Context, command *cli.Command) error {
 		pathList := command.StringArgs("path")
@@ -107,7 +151,31 @@ var cmdMerge = &cli.Command{
 			return err
 		}
 
+		journal, err := openJournal(command.String("journal"))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = journal.Close() }()
+
+		conflict, err := newConflictPolicy(command.String("on-conflict"))
+		if err != nil {
+			return err
+		}
+		plan := newPlan(command.String("plan"))
+		if plan != nil && command.IsSet("on-conflict") {
+			return errors.New("--on-conflict cannot be planned, different files are skipped")
+		}
 		fs := afero.NewOsFs()
-		return mergePath(fs, dstPath, srcPath, !command.Bool("execute"))
+		err = mergePath(fs, dstPath, srcPath, mergeOptions{
+			dryRun:   !command.Bool("execute") && plan == nil,
+			ignore:   newRespectIgnoreOptions(command),
+			journal:  journal,
+			plan:     plan,
+			conflict: conflict,
+		})
+		if err != nil {
+			return err
+		}
+		return plan.Save()
 	},
 }
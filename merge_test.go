@@ -51,7 +51,7 @@ func (s *MergeTestSuite) TestMergeDirectory() {
 	_ = f.Close()
 
 	// do merge
-	err = mergePath(fs, "/gallery", "/tmp", false)
+	err = mergePath(fs, "/gallery", "/tmp", mergeOptions{})
 	s.Require().NoError(err)
 
 	// check
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/cespare/xxhash"
+	"github.com/cockroachdb/errors"
+	"go.uber.org/zap"
+)
+
+// partSuffix marks what a move across devices copied so far. The part sits
+// next to the destination, a later run moving the same entry resumes it.
+const partSuffix = ".gofd-part"
+
+// partPathOf returns where the copy of an entry moving to dst is made.
+func partPathOf(dst string) string {
+	return filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+partSuffix)
+}
+
+// moveAcrossDevices moves path to dst on another file system. The entry is
+// copied to a part next to dst, synced, verified against the source and
+// given the metadata of the source. Only then the part is renamed to dst
+// and the source removed, so a crash leaves either the source alone or
+// both complete copies, which a later move of the entry finishes.
+func moveAcrossDevices(path string, dst string, mode reflinkMode) error {
+	part := partPathOf(dst)
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		err = copyTreeVerified(path, part, mode)
+	} else {
+		err = copyEntryVerified(path, info, part, mode)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "copy %s across devices", path)
+	}
+
+	err = os.Rename(part, dst)
+	if err != nil {
+		return err
+	}
+	err = syncDir(filepath.Dir(dst))
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(path)
+}
+
+// interruptedMove reports whether dst is the complete copy a move of path
+// across devices left when it was interrupted after renaming the part to
+// dst, all that is left to do is removing path then.
+func interruptedMove(path string, dst string) (bool, error) {
+	srcDev, ok, err := deviceOf(path)
+	if err != nil || !ok {
+		return false, err
+	}
+	dstDev, _, err := deviceOf(dst)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil || srcDev == dstDev {
+		return false, err
+	}
+	return sameTree(path, dst)
+}
+
+// sameTree reports whether dst has every entry of path, files with the same
+// size and xxhash and symbolic links with the same target.
+func sameTree(path string, dst string) (bool, error) {
+	same := true
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		targetInfo, err := os.Lstat(target)
+		if errors.Is(err, os.ErrNotExist) {
+			same = false
+			return filepath.SkipAll
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.Mode().Type() != targetInfo.Mode().Type():
+			same = false
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			targetLink, err := os.Readlink(target)
+			if err != nil {
+				return err
+			}
+			same = link == targetLink
+		case info.Mode().IsRegular():
+			same = info.Size() == targetInfo.Size()
+			if same {
+				same, err = fileHashEqual(p, target)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if !same {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return same, err
+}
+
+// copyEntryVerified copies a file or a symbolic link with its metadata.
+func copyEntryVerified(path string, info fs.FileInfo, part string, mode reflinkMode) error {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		err = os.Remove(part)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		err = os.Symlink(target, part)
+		if err != nil {
+			return err
+		}
+	case info.Mode().IsRegular():
+		err := resumeCopy(path, info.Size(), part, mode)
+		if err != nil {
+			return err
+		}
+	default:
+		return errors.Newf("cannot move %s across devices: %s", info.Mode().Type(), path)
+	}
+	return preserveMetadata(path, info, part)
+}
+
+// copyTreeVerified copies the directory path to part, resuming what an
+// interrupted run copied. Directories get their metadata last, copying
+// into them would change their timestamps.
+func copyTreeVerified(path string, part string, mode reflinkMode) error {
+	var dirs []string
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(part, rel)
+		if d.IsDir() {
+			dirs = append(dirs, rel)
+			return os.MkdirAll(target, 0700)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return copyEntryVerified(p, info, target, mode)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range slices.Backward(dirs) {
+		info, err := os.Lstat(filepath.Join(path, rel))
+		if err != nil {
+			return err
+		}
+		err = preserveMetadata(filepath.Join(path, rel), info, filepath.Join(part, rel))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resumeCopy copies the file src of size bytes to part and syncs it. When
+// part is what an interrupted copy left, i.e. a prefix of src, only the
+// rest is copied, unless mode clones the whole file. The result is verified
+// against src by xxhash.
+func resumeCopy(src string, size int64, part string, mode reflinkMode) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+
+	w, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = w.Close() }()
+
+	offset, err := resumableOffset(r, w, size)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		zap.L().Info("Resuming copy", zap.String("src", src), zap.String("part", part), zap.Int64("offset", offset))
+	}
+	err = w.Truncate(offset)
+	if err != nil {
+		return err
+	}
+	_, err = r.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	_, err = w.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	err = copyContents(w, r, mode)
+	if err != nil {
+		return err
+	}
+	err = w.Sync()
+	if err != nil {
+		return err
+	}
+
+	srcHash, err := xxHashFile(src)
+	if err != nil {
+		return err
+	}
+	partHash, err := xxHashFile(part)
+	if err != nil {
+		return err
+	}
+	if srcHash != partHash {
+		_ = os.Remove(part)
+		return errors.Newf("copy of %s does not match the source, xxhash 0x%x != 0x%x", src, partHash, srcHash)
+	}
+	return nil
+}
+
+// resumableOffset returns how much of src the part w already holds, zero
+// if w is not a prefix of src.
+func resumableOffset(src io.Reader, w *os.File, size int64) (int64, error) {
+	info, err := w.Stat()
+	if err != nil {
+		return 0, err
+	}
+	n := info.Size()
+	if n == 0 || n > size {
+		return 0, nil
+	}
+
+	srcHash := xxhash.New()
+	_, err = io.CopyN(srcHash, src, n)
+	if err != nil {
+		return 0, err
+	}
+	partHash := xxhash.New()
+	_, err = io.Copy(partHash, io.NewSectionReader(w, 0, n))
+	if err != nil {
+		return 0, err
+	}
+	if srcHash.Sum64() != partHash.Sum64() {
+		return 0, nil
+	}
+	return n, nil
+}
+
+// syncDir makes a rename in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if closeErr := d.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
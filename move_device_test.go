@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type MoveDeviceTestSuite struct {
+	suite.Suite
+	dir     string
+	content []byte
+}
+
+func TestMoveDevice(t *testing.T) {
+	suite.Run(t, new(MoveDeviceTestSuite))
+}
+
+func (s *MoveDeviceTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.content = bytes.Repeat([]byte("0123456789"), 10000)
+}
+
+func (s *MoveDeviceTestSuite) write(name string, content []byte) string {
+	path := filepath.Join(s.dir, name)
+	s.Require().NoError(os.MkdirAll(filepath.Dir(path), 0755))
+	s.Require().NoError(os.WriteFile(path, content, 0644))
+	return path
+}
+
+func (s *MoveDeviceTestSuite) TestResumeCopy() {
+	src := s.write("src.bin", s.content)
+	part := s.write("dst/.src.bin"+partSuffix, s.content[:1234])
+	s.NoError(resumeCopy(src, int64(len(s.content)), part, reflinkAuto))
+	b, err := os.ReadFile(part)
+	s.NoError(err)
+	s.Equal(s.content, b)
+
+	// a part that is not a prefix of the source is copied again
+	s.write("dst/.src.bin"+partSuffix, []byte("garbage"))
+	s.NoError(resumeCopy(src, int64(len(s.content)), part, reflinkAuto))
+	b, err = os.ReadFile(part)
+	s.NoError(err)
+	s.Equal(s.content, b)
+}
+
+func (s *MoveDeviceTestSuite) TestMoveFile() {
+	src := s.write("src/a.bin", s.content)
+	mtime := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	s.Require().NoError(os.Chmod(src, 0640))
+	s.Require().NoError(os.Chtimes(src, mtime, mtime))
+	dst := filepath.Join(s.dir, "a.bin")
+	s.write("."+filepath.Base(dst)+partSuffix, s.content[:10])
+
+	s.Require().NoError(moveAcrossDevices(src, dst, reflinkAuto))
+	s.NoFileExists(src)
+	s.NoFileExists(partPathOf(dst))
+	info, err := os.Stat(dst)
+	s.Require().NoError(err)
+	s.Equal(os.FileMode(0640), info.Mode().Perm())
+	s.True(info.ModTime().Equal(mtime))
+}
+
+func (s *MoveDeviceTestSuite) TestMoveTree() {
+	s.write("src/tree/a/b.txt", []byte("b"))
+	s.write("src/tree/c.txt", []byte("c"))
+	s.Require().NoError(os.Symlink("c.txt", filepath.Join(s.dir, "src/tree/link")))
+	mtime := time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC)
+	s.Require().NoError(os.Chtimes(filepath.Join(s.dir, "src/tree/a"), mtime, mtime))
+	dst := filepath.Join(s.dir, "dst")
+
+	s.Require().NoError(moveAcrossDevices(filepath.Join(s.dir, "src/tree"), dst, reflinkAuto))
+	s.NoDirExists(filepath.Join(s.dir, "src/tree"))
+	s.NoDirExists(partPathOf(dst))
+	s.FileExists(filepath.Join(dst, "a/b.txt"))
+	s.FileExists(filepath.Join(dst, "c.txt"))
+	target, err := os.Readlink(filepath.Join(dst, "link"))
+	s.NoError(err)
+	s.Equal("c.txt", target)
+	info, err := os.Stat(filepath.Join(dst, "a"))
+	s.Require().NoError(err)
+	s.True(info.ModTime().Equal(mtime))
+}
+
+func (s *MoveDeviceTestSuite) TestResumeAfterRename() {
+	// the sources need a file system of their own
+	srcDir, err := os.MkdirTemp("/dev/shm", "gofd-move-")
+	if err != nil {
+		s.T().Skip("no tmpfs at /dev/shm")
+	}
+	defer func() { _ = os.RemoveAll(srcDir) }()
+	srcDev, _, err := deviceOf(srcDir)
+	s.Require().NoError(err)
+	dstDev, _, err := deviceOf(s.dir)
+	s.Require().NoError(err)
+	if srcDev == dstDev {
+		s.T().Skip("/dev/shm is on the same file system as " + s.dir)
+	}
+
+	// a crash after renaming the part to dst left both
+	for _, name := range []string{"a.bin", "tree/b.bin"} {
+		s.Require().NoError(os.MkdirAll(filepath.Dir(filepath.Join(srcDir, name)), 0755))
+		s.Require().NoError(os.WriteFile(filepath.Join(srcDir, name), s.content, 0644))
+		s.write(filepath.Join("dst", name), s.content)
+	}
+	dst := filepath.Join(s.dir, "dst")
+	action := MoveAction{fs: afero.NewOsFs(), dst: dst}
+	s.Require().NoError(action.Execute(filepath.Join(srcDir, "a.bin")))
+	s.NoFileExists(filepath.Join(srcDir, "a.bin"))
+	s.Require().NoError(action.Execute(filepath.Join(srcDir, "tree")))
+	s.NoDirExists(filepath.Join(srcDir, "tree"))
+	s.FileExists(filepath.Join(dst, "tree", "b.bin"))
+
+	// a different destination is a conflict
+	other := filepath.Join(srcDir, "c.bin")
+	s.Require().NoError(os.WriteFile(other, s.content, 0644))
+	s.write("dst/c.bin", s.content[:10])
+	s.ErrorIs(action.Execute(other), ErrFileExists)
+	s.FileExists(other)
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cespare/xxhash"
+	"github.com/cockroachdb/errors"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v3"
+	"go.uber.org/zap"
+)
+
+// planVersion is the version of the plan file format.
+const planVersion = 1
+
+// planOperation is an operation a command intended to do. The metadata of
+// Src is recorded when planning, apply refuses to touch it if it changed.
+// XXHash is the hash of a file, or of the entries below a directory.
+// Preserve and Reflink are the options of copies and moves, GzipOnly the
+// one of extractions.
+type planOperation struct {
+	Op       journalOp `json:"op"`
+	Src      string    `json:"src"`
+	Dst      string    `json:"dst,omitempty"`
+	IsDir    bool      `json:"is_dir,omitempty"`
+	Size     int64     `json:"size"`
+	Mtime    time.Time `json:"mtime"`
+	XXHash   string    `json:"xxhash,omitempty"`
+	Preserve bool      `json:"preserve,omitempty"`
+	Reflink  string    `json:"reflink,omitempty"`
+	GzipOnly bool      `json:"gzip_only,omitempty"`
+}
+
+// planFile is what --plan writes and gofd apply reads.
+type planFile struct {
+	Version    int             `json:"version"`
+	Created    time.Time       `json:"created"`
+	Command    []string        `json:"command"`
+	Operations []planOperation `json:"operations"`
+}
+
+// plan collects operations instead of doing them. A nil plan collects
+// nothing, its methods are safe for concurrent use.
+type plan struct {
+	path string
+
+	mu         sync.Mutex
+	operations []planOperation
+}
+
+func planFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "plan",
+		Usage: "write the operations to this file instead of doing them, run them later with gofd apply",
+	}
+}
+
+// newPlan returns a plan saved to path, or nil if path is empty.
+func newPlan(path string) *plan {
+	if path == "" {
+		return nil
+	}
+	return &plan{path: path}
+}
+
+// describePlanned returns o on src with the current metadata of src.
+func describePlanned(o planOperation, src string) (planOperation, error) {
+	var err error
+	o.Src, err = filepath.Abs(src)
+	if err != nil {
+		return o, err
+	}
+	if o.Dst != "" {
+		o.Dst, err = filepath.Abs(o.Dst)
+		if err != nil {
+			return o, err
+		}
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return o, err
+	}
+	o.IsDir = info.IsDir()
+	o.Size = info.Size()
+	o.Mtime = info.ModTime()
+	o.XXHash, err = plannedHash(src, info)
+	return o, err
+}
+
+// plannedHash returns the xxhash of the file path, of the entries below the
+// directory path, or nothing for other entries.
+func plannedHash(path string, info fs.FileInfo) (string, error) {
+	var h uint64
+	var err error
+	switch {
+	case info.IsDir():
+		h, err = xxHashTree(path)
+	case info.Mode().IsRegular():
+		h, err = xxHashFile(path)
+	default:
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("0x%x", h), nil
+}
+
+// xxHashTree hashes the names, types, sizes and modification times of the
+// entries below dir. Adding, removing or changing a file anywhere in dir
+// changes it, while the metadata of dir itself only tells about its direct
+// entries.
+func xxHashTree(dir string) (uint64, error) {
+	h := xxhash.New()
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		size := info.Size()
+		if info.IsDir() {
+			// the size of a directory depends on the file system
+			size = 0
+		}
+		_, err = fmt.Fprintf(h, "%s\x00%s\x00%d\x00%d\n", rel, info.Mode(), size, info.ModTime().UnixNano())
+		return err
+	})
+	return h.Sum64(), err
+}
+
+// Add records op on src, dst is the destination of moves and copies or the
+// identical file of a duplicate.
+func (p *plan) Add(op journalOp, src string, dst string) error {
+	return p.AddOperation(planOperation{Op: op, Dst: dst}, src)
+}
+
+// AddOperation records o on src, o carries the operation, its destination
+// and its options.
+func (p *plan) AddOperation(o planOperation, src string) error {
+	if p == nil {
+		return nil
+	}
+	o, err := describePlanned(o, src)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.operations = append(p.operations, o)
+	return nil
+}
+
+// Save writes the plan sorted by source, so plans diff well in review.
+func (p *plan) Save() error {
+	if p == nil {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sort.SliceStable(p.operations, func(i, j int) bool {
+		return p.operations[i].Src < p.operations[j].Src
+	})
+	b, err := json.MarshalIndent(planFile{
+		Version:    planVersion,
+		Created:    time.Now(),
+		Command:    os.Args,
+		Operations: p.operations,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := p.path + ".tmp"
+	err = os.WriteFile(tmp, append(b, '\n'), 0644)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp, p.path)
+	if err != nil {
+		return err
+	}
+	zap.L().Info("Plan written", zap.String("path", p.path), zap.Int("operations", len(p.operations)))
+	return nil
+}
+
+// plannedAction is implemented by actions that can be planned, Plan returns
+// what Execute would do to path without touching it, the plan records the
+// metadata of path. An operation without Op means nothing is done to path.
+type plannedAction interface {
+	Action
+	Plan(path string) (planOperation, error)
+}
+
+// PlanAction adds the operation of its action to a plan instead of
+// executing it.
+type PlanAction struct {
+	action plannedAction
+	plan   *plan
+}
+
+func (a PlanAction) Execute(path string) error {
+	o, err := a.action.Plan(path)
+	if err != nil || o.Op == "" {
+		return err
+	}
+	return a.plan.AddOperation(o, path)
+}
+
+// treePlanAction plans an action that consumes whole trees, the walk must
+// not descend into them either.
+type treePlanAction struct {
+	PlanAction
+}
+
+func (treePlanAction) ConsumesTree() {}
+
+// newPlanAction wraps action so it is planned into p, nil p keeps action.
+func newPlanAction(action Action, p *plan) (Action, error) {
+	if p == nil {
+		return action, nil
+	}
+	planned, ok := action.(plannedAction)
+	if !ok {
+		return nil, errors.New("only delete, extract, gz and the copy and move actions can be planned")
+	}
+	a := PlanAction{action: planned, plan: p}
+	if _, ok := action.(treeAction); ok {
+		return treePlanAction{a}, nil
+	}
+	return a, nil
+}
+
+// verifyPlanned checks that the source of o is unchanged since planning.
+func verifyPlanned(o planOperation) error {
+	info, err := os.Lstat(o.Src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() != o.IsDir || (!o.IsDir && info.Size() != o.Size) || !info.ModTime().Equal(o.Mtime) {
+		return errors.Newf("%s changed since the plan was made", o.Src)
+	}
+	if o.XXHash == "" {
+		return nil
+	}
+	h, err := plannedHash(o.Src, info)
+	if err != nil {
+		return err
+	}
+	if h != o.XXHash {
+		return errors.Newf("%s changed since the plan was made", o.Src)
+	}
+	return nil
+}
+
+// applyOperation verifies the preconditions of o and executes it. dirs
+// collects the directories whose metadata is preserved once everything is
+// copied into them.
+func applyOperation(o planOperation, journal *journal, dirs *dirMetadata) error {
+	err := verifyPlanned(o)
+	if err != nil {
+		return err
+	}
+	reflink, err := newReflinkMode(o.Reflink)
+	if err != nil {
+		return err
+	}
+
+	dir, name := filepath.Split(o.Dst)
+	switch o.Op {
+	case opMove:
+		return MoveAction{fs: afero.NewOsFs(), dst: dir, name: name, journal: journal,
+			reflink: reflink}.Execute(o.Src)
+	case opCopy:
+		return CopyAction{dst: dir, name: name, preserve: o.Preserve, reflink: reflink}.Execute(o.Src)
+	case opMkdir:
+		err = os.MkdirAll(o.Dst, 0755)
+		if err == nil && o.Preserve {
+			dirs.Add(o.Src, o.Dst)
+		}
+		return err
+	case opTrash:
+		return trashOrDelete(o.Src, journal)
+	case opExtract:
+		a := ExtractAction{journal: journal, gzipOnly: o.GzipOnly}
+		planned, err := a.Plan(o.Src)
+		if err != nil {
+			return err
+		}
+		if planned.Dst != o.Dst {
+			return errors.Newf("%s no longer extracts to %s", o.Src, o.Dst)
+		}
+		return a.Execute(o.Src)
+	case opRemoveDuplicate:
+		ok, err := fileHashEqual(o.Src, o.Dst)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errors.Newf("%s is no longer the same as %s", o.Src, o.Dst)
+		}
+		return removeDuplicate(o.Src, o.Dst, journal)
+	}
+	return errors.Newf("unknown operation: %s", o.Op)
+}
+
+var cmdApply = &cli.Command{
+	Name:  "apply",
+	Usage: "Execute a plan written with --plan, skipping entries that changed since",
+	Arguments: []cli.Argument{
+		&cli.StringArg{Name: "plan", Config: trimSpaceConfig},
+	},
+	Flags: []cli.Flag{
+		journalFlag(),
+	},
+	Action: func(ctx context.Context, command *cli.Command) error {
+		path := command.StringArg("plan")
+		if path == "" {
+			return errors.New("plan is required")
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var p planFile
+		err = json.Unmarshal(b, &p)
+		if err != nil {
+			return errors.Wrapf(err, "plan: %s", path)
+		}
+		if p.Version != planVersion {
+			return errors.Newf("unsupported plan version: %d", p.Version)
+		}
+
+		journal, err := openJournal(command.String("journal"))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = journal.Close() }()
+
+		failed := 0
+		dirs := newDirMetadata()
+		for _, o := range p.Operations {
+			err = applyOperation(o, journal, dirs)
+			if err != nil {
+				failed++
+				fmt.Printf("Skipped %s of %s: %v\n", o.Op, o.Src, err)
+			}
+		}
+		dirs.Apply(func(path string, err error) {
+			failed++
+			fmt.Printf("Skipped the metadata of %s: %v\n", path, err)
+		})
+		if failed > 0 {
+			return errors.Newf("%d of %d operations failed", failed, len(p.Operations))
+		}
+		return nil
+	},
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type PlanTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func TestPlan(t *testing.T) {
+	suite.Run(t, new(PlanTestSuite))
+}
+
+func (s *PlanTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.T().Setenv("XDG_DATA_HOME", filepath.Join(s.dir, "data"))
+}
+
+func (s *PlanTestSuite) write(name string, content string) string {
+	path := filepath.Join(s.dir, name)
+	s.Require().NoError(os.MkdirAll(filepath.Dir(path), 0755))
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func (s *PlanTestSuite) load(path string) planFile {
+	b, err := os.ReadFile(path)
+	s.Require().NoError(err)
+	var p planFile
+	s.Require().NoError(json.Unmarshal(b, &p))
+	return p
+}
+
+func (s *PlanTestSuite) TestPlanAction() {
+	b := s.write("b.txt", "b")
+	a := s.write("a.txt", "a")
+	dst := filepath.Join(s.dir, "dst")
+	path := filepath.Join(s.dir, "plan.json")
+	p := newPlan(path)
+
+	action, err := newPlanAction(DeleteAction{}, p)
+	s.Require().NoError(err)
+	s.NoError(action.Execute(b))
+	action, err = newPlanAction(MoveAction{fs: afero.NewOsFs(), dst: dst}, p)
+	s.Require().NoError(err)
+	s.NoError(action.Execute(a))
+	s.NoError(p.Save())
+
+	s.FileExists(a)
+	s.FileExists(b)
+	s.NoDirExists(dst)
+
+	f := s.load(path)
+	s.Equal(planVersion, f.Version)
+	s.Require().Len(f.Operations, 2)
+	s.Equal(planOperation{
+		Op: opMove, Src: a, Dst: filepath.Join(dst, "a.txt"), Size: 1,
+		Mtime: f.Operations[0].Mtime, XXHash: f.Operations[0].XXHash, Reflink: "auto",
+	}, f.Operations[0])
+	s.Equal(opTrash, f.Operations[1].Op)
+	s.Equal(b, f.Operations[1].Src)
+
+	_, err = newPlanAction(&PrintAction{}, p)
+	s.Error(err)
+}
+
+func (s *PlanTestSuite) TestApply() {
+	src := s.write("src/a.txt", "a")
+	dst := filepath.Join(s.dir, "dst", "a.txt")
+	o, err := describePlanned(planOperation{Op: opMove, Dst: dst}, src)
+	s.Require().NoError(err)
+
+	s.NoError(applyOperation(o, nil, nil))
+	s.NoFileExists(src)
+	s.FileExists(dst)
+
+	err = applyOperation(o, nil, nil)
+	s.ErrorIs(err, os.ErrNotExist)
+}
+
+func (s *PlanTestSuite) TestApplyTreeCopy() {
+	s.write("src/a.txt", "a")
+	s.write("src/d/b.txt", "b")
+	src := filepath.Join(s.dir, "src")
+	old := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.Require().NoError(os.Chtimes(filepath.Join(src, "d"), old, old))
+	dst := filepath.Join(s.dir, "dst")
+	p := newPlan(filepath.Join(s.dir, "plan.json"))
+
+	copyTree, err := newAction("copy-tree-to:"+dst, actionOptions{roots: []string{src}, preserve: true,
+		reflink: reflinkNever})
+	s.Require().NoError(err)
+	action, err := newPlanAction(copyTree, p)
+	s.Require().NoError(err)
+	s.Require().NoError(filepath.WalkDir(src, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return action.Execute(path)
+	}))
+	s.Require().NoError(p.Save())
+	s.NoDirExists(dst)
+
+	f := s.load(p.path)
+	s.Require().Len(f.Operations, 4)
+	dirs := newDirMetadata()
+	for _, o := range f.Operations {
+		s.True(o.Preserve || o.Dst == dst, o.Src)
+		if o.IsDir {
+			s.Equal(opMkdir, o.Op)
+		} else {
+			s.Equal(opCopy, o.Op)
+			s.Equal("never", o.Reflink)
+		}
+		s.Require().NoError(applyOperation(o, nil, dirs))
+	}
+	dirs.Apply(func(path string, err error) { s.Fail(path, err) })
+
+	s.FileExists(filepath.Join(dst, "a.txt"))
+	s.FileExists(filepath.Join(dst, "d", "b.txt"))
+	info, err := os.Stat(filepath.Join(dst, "d"))
+	s.Require().NoError(err)
+	s.True(old.Equal(info.ModTime()), info.ModTime())
+}
+
+func (s *PlanTestSuite) TestChangedSincePlanned() {
+	src := s.write("a.txt", "a")
+	o, err := describePlanned(planOperation{Op: opTrash}, src)
+	s.Require().NoError(err)
+
+	// same size and mtime, different contents
+	s.write("a.txt", "b")
+	s.Require().NoError(os.Chtimes(src, time.Time{}, o.Mtime))
+	s.ErrorContains(applyOperation(o, nil, nil), "changed since")
+	s.FileExists(src)
+
+	s.Require().NoError(os.Chtimes(src, time.Time{}, o.Mtime.Add(time.Second)))
+	s.ErrorContains(verifyPlanned(o), "changed since")
+}
+
+func (s *PlanTestSuite) TestDirectoryChangedSincePlanned() {
+	s.write("d/sub/a.txt", "a")
+	dir := filepath.Join(s.dir, "d")
+	o, err := describePlanned(planOperation{Op: opTrash}, dir)
+	s.Require().NoError(err)
+	s.NotEmpty(o.XXHash)
+	s.NoError(verifyPlanned(o))
+
+	// the mtime of d does not change when a file deep down is added
+	info, err := os.Stat(dir)
+	s.Require().NoError(err)
+	s.write("d/sub/b.txt", "b")
+	s.Require().NoError(os.Chtimes(dir, time.Time{}, info.ModTime()))
+	s.ErrorContains(applyOperation(o, nil, nil), "changed since")
+	s.DirExists(dir)
+}
+
+func (s *PlanTestSuite) TestDeduplicate() {
+	kept := s.write("path1/a.txt", "a")
+	dup := s.write("path2/b.txt", "a")
+	s.write("path2/c.txt", "c")
+	p := newPlan(filepath.Join(s.dir, "plan.json"))
+	s.Require().NoError(deduplicate(filepath.Join(s.dir, "path1"), filepath.Join(s.dir, "path2"),
+		ignoreOptions{}, nil, p))
+	s.Require().Len(p.operations, 1)
+	s.Equal(opRemoveDuplicate, p.operations[0].Op)
+	s.Equal(dup, p.operations[0].Src)
+	s.Equal(kept, p.operations[0].Dst)
+	s.FileExists(dup)
+}
+
+func (s *PlanTestSuite) TestRemoveDuplicate() {
+	src := s.write("src/a.txt", "a")
+	dup := s.write("dst/a.txt", "a")
+	p := newPlan(filepath.Join(s.dir, "plan.json"))
+	s.Require().NoError(planMerge(afero.NewOsFs(), src, dup, p))
+	s.Require().Len(p.operations, 1)
+	o := p.operations[0]
+	s.Equal(opRemoveDuplicate, o.Op)
+
+	s.write("dst/a.txt", "b")
+	s.ErrorContains(applyOperation(o, nil, nil), "no longer the same")
+	s.FileExists(src)
+
+	s.write("dst/a.txt", "a")
+	s.NoError(applyOperation(o, nil, nil))
+	s.NoFileExists(src)
+}
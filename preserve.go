@@ -0,0 +1,89 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+)
+
+// preserveMetadata copies the xattrs, ownership, mode and timestamps of src,
+// described by info, to dst. Ownership is kept only where the user may
+// change it, like cp -p. Symbolic links keep their xattrs and owner only.
+func preserveMetadata(src string, info fs.FileInfo, dst string) error {
+	err := copyXattrs(src, dst)
+	if err != nil {
+		return errors.Wrap(err, "copy xattrs")
+	}
+
+	st, ok := getSysStat(info)
+	if ok {
+		err = os.Lchown(dst, int(st.Uid), int(st.Gid))
+		if err != nil && !errors.Is(err, os.ErrPermission) {
+			return err
+		}
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+
+	// chown clears the setuid and setgid bits, so the mode goes after it
+	err = os.Chmod(dst, info.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid|os.ModeSticky))
+	if err != nil {
+		return err
+	}
+	atime := info.ModTime()
+	if ok && !st.Atime.IsZero() {
+		atime = st.Atime
+	}
+	return os.Chtimes(dst, atime, info.ModTime())
+}
+
+// dirMetadata collects the directories a tree copy created with the source
+// they were created for. They get the metadata of their sources only once
+// everything below them is copied, copying into a directory changes its
+// timestamps and a read-only one cannot be copied into.
+type dirMetadata struct {
+	mu   sync.Mutex
+	dirs map[string]string
+}
+
+func newDirMetadata() *dirMetadata {
+	return &dirMetadata{dirs: make(map[string]string)}
+}
+
+func (d *dirMetadata) Add(src string, dst string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.dirs[dst] = src
+}
+
+// Apply preserves the metadata of every collected directory, deepest first.
+// A nil dirMetadata has nothing to apply.
+func (d *dirMetadata) Apply(fail func(path string, err error)) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// a directory sorts before everything below it
+	dsts := make([]string, 0, len(d.dirs))
+	for dst := range d.dirs {
+		dsts = append(dsts, dst)
+	}
+	slices.Sort(dsts)
+	for _, dst := range slices.Backward(dsts) {
+		src := d.dirs[dst]
+		info, err := os.Lstat(src)
+		if err == nil {
+			err = preserveMetadata(src, info, dst)
+		}
+		if err != nil {
+			fail(src, err)
+		}
+	}
+	clear(d.dirs)
+}
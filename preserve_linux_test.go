@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/sys/unix"
+)
+
+type TreeActionTestSuite struct {
+	suite.Suite
+	dir string
+	src string
+}
+
+func TestTreeAction(t *testing.T) {
+	suite.Run(t, new(TreeActionTestSuite))
+}
+
+func (s *TreeActionTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.src = filepath.Join(s.dir, "src")
+	for _, name := range []string{"a/config.json", "b/config.json"} {
+		path := filepath.Join(s.src, name)
+		s.Require().NoError(os.MkdirAll(filepath.Dir(path), 0755))
+		s.Require().NoError(os.WriteFile(path, []byte(name), 0644))
+	}
+}
+
+func (s *TreeActionTestSuite) TestDestination() {
+	roots := []string{"src", "src/b"}
+	s.Equal("dst/a/config.json", destinationOf("dst", "", roots, "src/a/config.json"))
+	s.Equal("dst/config.json", destinationOf("dst", "", roots, "src/b/config.json"))
+	s.Equal("dst", destinationOf("dst", "", roots, "src"))
+	s.Equal("dst/other.json", destinationOf("dst", "", roots, "other/other.json"))
+	s.Equal("dst/x.json", destinationOf("dst", "x.json", nil, "src/a/config.json"))
+}
+
+func (s *TreeActionTestSuite) TestCopyTree() {
+	dst := filepath.Join(s.dir, "dst")
+	action := CopyAction{dst: dst, roots: []string{s.src}}
+	for _, name := range []string{"a/config.json", "b/config.json"} {
+		s.NoError(action.Execute(filepath.Join(s.src, name)))
+		b, err := os.ReadFile(filepath.Join(dst, name))
+		s.NoError(err)
+		s.Equal(name, string(b))
+	}
+	s.ErrorIs(action.Execute(filepath.Join(s.src, "a/config.json")), ErrFileExists)
+	s.FileExists(filepath.Join(s.src, "a/config.json"))
+}
+
+func (s *TreeActionTestSuite) TestMoveTree() {
+	dst := filepath.Join(s.dir, "dst")
+	action := MoveAction{fs: afero.NewOsFs(), dst: dst, roots: []string{s.src}}
+	s.NoError(action.Execute(filepath.Join(s.src, "a/config.json")))
+	s.NoError(action.Execute(filepath.Join(s.src, "b")))
+	s.FileExists(filepath.Join(dst, "a/config.json"))
+	s.FileExists(filepath.Join(dst, "b/config.json"))
+	s.NoFileExists(filepath.Join(s.src, "a/config.json"))
+	s.NoDirExists(filepath.Join(s.src, "b"))
+}
+
+func (s *TreeActionTestSuite) TestPreserve() {
+	src := filepath.Join(s.src, "a/config.json")
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	s.Require().NoError(os.Chmod(src, 0600))
+	s.Require().NoError(os.Chtimes(src, mtime, mtime))
+	err := unix.Lsetxattr(src, "user.gofd", []byte("kept"), 0)
+	xattrs := err == nil
+
+	dst := filepath.Join(s.dir, "dst")
+	s.Require().NoError(CopyAction{dst: dst, roots: []string{s.src}, preserve: true}.Execute(src))
+	info, err := os.Stat(filepath.Join(dst, "a/config.json"))
+	s.Require().NoError(err)
+	s.Equal(os.FileMode(0600), info.Mode().Perm())
+	s.True(info.ModTime().Equal(mtime))
+	if xattrs {
+		value, err := getXattr(filepath.Join(dst, "a/config.json"), "user.gofd")
+		s.NoError(err)
+		s.Equal("kept", string(value))
+	}
+
+	s.Require().NoError(CopyAction{dst: filepath.Join(s.dir, "plain")}.Execute(src))
+	info, err = os.Stat(filepath.Join(s.dir, "plain", "config.json"))
+	s.Require().NoError(err)
+	s.False(info.ModTime().Equal(mtime))
+}
+
+func (s *TreeActionTestSuite) TestPreserveDirectories() {
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	a := filepath.Join(s.src, "a")
+	s.Require().NoError(os.Chmod(s.src, 0700))
+	s.Require().NoError(os.Chmod(a, 0555))
+	s.Require().NoError(os.Chtimes(a, mtime, mtime))
+	defer func() { _ = os.Chmod(a, 0755) }()
+
+	dst := filepath.Join(s.dir, "dst")
+	action, err := newAction("copy-tree-to:"+dst, actionOptions{roots: []string{s.src}, preserve: true})
+	s.Require().NoError(err)
+	r := newActionRunner(action, 4)
+	for _, p := range []string{s.src, a, filepath.Join(a, "config.json")} {
+		info, err := os.Stat(p)
+		s.Require().NoError(err)
+		r.Submit(p, info.IsDir())
+	}
+	s.Require().NoError(r.Wait())
+
+	info, err := os.Stat(filepath.Join(dst, "a"))
+	s.Require().NoError(err)
+	s.Equal(os.FileMode(0555), info.Mode().Perm())
+	s.True(info.ModTime().Equal(mtime))
+	s.FileExists(filepath.Join(dst, "a/config.json"))
+	defer func() { _ = os.Chmod(filepath.Join(dst, "a"), 0755) }()
+
+	info, err = os.Stat(dst)
+	s.Require().NoError(err)
+	s.Equal(os.FileMode(0755), info.Mode().Perm())
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io"
+
+	"github.com/cockroachdb/errors"
+	"github.com/urfave/cli/v3"
+)
+
+// reflinkMode decides whether copies share the extents of their source, on
+// file systems that can clone files like Btrfs and XFS.
+type reflinkMode int
+
+const (
+	// reflinkAuto clones where possible and copies in the kernel or in
+	// user space otherwise
+	reflinkAuto reflinkMode = iota
+	// reflinkAlways fails where cloning is not possible
+	reflinkAlways
+	// reflinkNever always writes a copy of the data
+	reflinkNever
+)
+
+// ErrReflinkUnsupported is returned by copies with reflinkAlways when the
+// file system, or the platform, cannot clone files.
+var ErrReflinkUnsupported = errors.New("reflink not supported")
+
+func newReflinkMode(s string) (reflinkMode, error) {
+	switch s {
+	case "", "auto":
+		return reflinkAuto, nil
+	case "always":
+		return reflinkAlways, nil
+	case "never":
+		return reflinkNever, nil
+	}
+	return 0, errors.Newf("unknown reflink mode: %s", s)
+}
+
+func (m reflinkMode) String() string {
+	switch m {
+	case reflinkAlways:
+		return "always"
+	case reflinkNever:
+		return "never"
+	}
+	return "auto"
+}
+
+func reflinkFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "reflink",
+		Usage: "clone the data of copied files: auto, always or never",
+		Value: "auto",
+	}
+}
+
+// plainCopy copies in user space, hiding ReadFrom and WriteTo so io.Copy
+// does not use the kernel copies of *os.File.
+func plainCopy(dst io.Writer, src io.Reader) error {
+	_, err := io.Copy(struct{ io.Writer }{dst}, struct{ io.Reader }{src})
+	return err
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/sys/unix"
+)
+
+// copyChunk is the most copy_file_range and sendfile copy per call.
+const copyChunk = 1 << 30
+
+// copyContents copies the rest of src from its offset to dst at its
+// offset. It clones src with FICLONE first, then tries copy_file_range,
+// sendfile and a copy in user space. A clone always covers the whole file.
+// With reflinkNever copy_file_range is skipped too, it clones on some file
+// systems.
+func copyContents(dst *os.File, src *os.File, mode reflinkMode) error {
+	if mode != reflinkNever {
+		err := unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+		if err == nil {
+			_, err = dst.Seek(0, io.SeekEnd)
+			return err
+		}
+		if mode == reflinkAlways {
+			if errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EXDEV) || errors.Is(err, unix.EINVAL) ||
+				errors.Is(err, unix.ENOTTY) || errors.Is(err, unix.ENOSYS) {
+				return errors.Wrapf(ErrReflinkUnsupported, "clone %s: %v", src.Name(), err)
+			}
+			return errors.Wrapf(err, "clone %s", src.Name())
+		}
+
+		done, err := kernelCopy(dst, src, func(n int) (int, error) {
+			return unix.CopyFileRange(int(src.Fd()), nil, int(dst.Fd()), nil, n, 0)
+		})
+		if done || err != nil {
+			return err
+		}
+	}
+
+	done, err := kernelCopy(dst, src, func(n int) (int, error) {
+		return unix.Sendfile(int(dst.Fd()), int(src.Fd()), nil, n)
+	})
+	if done || err != nil {
+		return err
+	}
+	return plainCopy(dst, src)
+}
+
+// kernelCopy calls copyN until the end of src. It reports false if the
+// kernel cannot copy between these files, the offsets of both files then
+// tell where the copy is to be continued.
+func kernelCopy(dst *os.File, src *os.File, copyN func(n int) (int, error)) (bool, error) {
+	for {
+		n, err := copyN(copyChunk)
+		if err != nil {
+			if errors.Is(err, unix.EINTR) || errors.Is(err, unix.EAGAIN) {
+				continue
+			}
+			if errors.Is(err, unix.ENOSYS) || errors.Is(err, unix.EXDEV) || errors.Is(err, unix.EINVAL) ||
+				errors.Is(err, unix.EOPNOTSUPP) || errors.Is(err, unix.EPERM) {
+				return false, nil
+			}
+			return false, errors.Wrapf(err, "copy %s", src.Name())
+		}
+		if n == 0 {
+			return true, nil
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+)
+
+// tempDir returns a new directory in parent, removed after the test.
+func (s *ReflinkTestSuite) tempDir(parent string) string {
+	dir, err := os.MkdirTemp(parent, "gofd-reflink-")
+	s.Require().NoError(err)
+	s.T().Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+func (s *ReflinkTestSuite) TestAlwaysUnsupported() {
+	var st unix.Statfs_t
+	if err := unix.Statfs("/dev/shm", &st); err != nil || st.Type != unix.TMPFS_MAGIC {
+		s.T().Skip("no tmpfs at /dev/shm")
+	}
+	dir := s.tempDir("/dev/shm")
+	src := filepath.Join(dir, "src.bin")
+	s.Require().NoError(os.WriteFile(src, s.content, 0644))
+
+	// a failed copy leaves nothing behind
+	dst := filepath.Join(dir, "clone.bin")
+	s.ErrorIs(copyFile(src, dst, reflinkAlways), ErrReflinkUnsupported)
+	s.NoFileExists(dst)
+}
+
+// TestAlways needs GOFD_REFLINK_DIR set to a directory on a file system
+// that clones files, like Btrfs or XFS.
+func (s *ReflinkTestSuite) TestAlways() {
+	parent := os.Getenv("GOFD_REFLINK_DIR")
+	if parent == "" {
+		s.T().Skip("GOFD_REFLINK_DIR is not set to a directory on Btrfs or XFS")
+	}
+	dir := s.tempDir(parent)
+	src := filepath.Join(dir, "src.bin")
+	s.Require().NoError(os.WriteFile(src, s.content, 0644))
+
+	dst := filepath.Join(dir, "clone.bin")
+	s.Require().NoError(copyFile(src, dst, reflinkAlways))
+	b, err := os.ReadFile(dst)
+	s.NoError(err)
+	s.Equal(s.content, b)
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import (
+	"os"
+
+	"github.com/cockroachdb/errors"
+)
+
+// copyContents copies the rest of src from its offset to dst at its offset.
+// Cloning is only implemented on Linux.
+func copyContents(dst *os.File, src *os.File, mode reflinkMode) error {
+	if mode == reflinkAlways {
+		return errors.Wrap(ErrReflinkUnsupported, "only supported on Linux")
+	}
+	return plainCopy(dst, src)
+}
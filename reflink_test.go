@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ReflinkTestSuite struct {
+	suite.Suite
+	dir     string
+	src     string
+	content []byte
+}
+
+func TestReflink(t *testing.T) {
+	suite.Run(t, new(ReflinkTestSuite))
+}
+
+func (s *ReflinkTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.content = bytes.Repeat([]byte("0123456789abcdef"), 64*1024)
+	s.src = filepath.Join(s.dir, "src.bin")
+	s.Require().NoError(os.WriteFile(s.src, s.content, 0644))
+}
+
+func (s *ReflinkTestSuite) TestModes() {
+	for _, name := range []string{"", "auto", "always", "never"} {
+		_, err := newReflinkMode(name)
+		s.NoError(err)
+	}
+	_, err := newReflinkMode("sometimes")
+	s.Error(err)
+}
+
+func (s *ReflinkTestSuite) TestCopyFile() {
+	for _, mode := range []reflinkMode{reflinkAuto, reflinkNever} {
+		dst := filepath.Join(s.dir, "dst.bin")
+		s.Require().NoError(copyFile(s.src, dst, mode))
+		b, err := os.ReadFile(dst)
+		s.NoError(err)
+		s.Equal(s.content, b)
+		s.Require().NoError(os.Remove(dst))
+	}
+}
+
+func (s *ReflinkTestSuite) TestOffsets() {
+	for _, mode := range []reflinkMode{reflinkAuto, reflinkNever} {
+		r, err := os.Open(s.src)
+		s.Require().NoError(err)
+		w, err := os.Create(filepath.Join(s.dir, "part.bin"))
+		s.Require().NoError(err)
+
+		// the rest of the source goes after what the destination has
+		_, err = w.Write(s.content[:1000])
+		s.Require().NoError(err)
+		_, err = r.Seek(1000, io.SeekStart)
+		s.Require().NoError(err)
+		s.NoError(copyContents(w, r, mode))
+		s.NoError(w.Close())
+		s.NoError(r.Close())
+
+		b, err := os.ReadFile(filepath.Join(s.dir, "part.bin"))
+		s.NoError(err)
+		s.Equal(s.content, b)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"path/filepath"
 
 	"github.com/cockroachdb/errors"
+	"github.com/spf13/afero"
 	"github.com/urfave/cli/v3"
 )
 
@@ -26,6 +27,7 @@ var cmdStat = &cli.Command{
 			Aliases: []string{"o"},
 			Value:   "-",
 		},
+		respectIgnoreFlag(),
 	},
 	Action: func(ctx context.Context, command *cli.Command) error {
 		path := command.StringArg("path")
@@ -52,10 +54,14 @@ var cmdStat = &cli.Command{
 			return err
 		}
 
+		ignore := newIgnoreRules(afero.NewOsFs(), path, newRespectIgnoreOptions(command))
 		err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
+			if skip, err := ignore.Skip(path, d); skip || err != nil {
+				return err
+			}
 			if d.IsDir() {
 				return nil
 			}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+// sysStat holds the platform specific parts of fs.FileInfo.
+type sysStat struct {
+	Dev   uint64
+	Rdev  uint64
+	Ino   uint64
+	Nlink uint64
+	Uid   uint32
+	Gid   uint32
+	Atime time.Time
+	Ctime time.Time
+}
+
+func getSysStat(info fs.FileInfo) (sysStat, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return sysStat{}, false
+	}
+	return sysStat{
+		Dev:   uint64(st.Dev),
+		Rdev:  uint64(st.Rdev),
+		Ino:   uint64(st.Ino),
+		Nlink: uint64(st.Nlink),
+		Uid:   st.Uid,
+		Gid:   st.Gid,
+		Atime: time.Unix(st.Atim.Unix()),
+		Ctime: time.Unix(st.Ctim.Unix()),
+	}, true
+}
@@ -0,0 +1,24 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"io/fs"
+	"time"
+)
+
+// sysStat holds the platform specific parts of fs.FileInfo.
+type sysStat struct {
+	Dev   uint64
+	Rdev  uint64
+	Ino   uint64
+	Nlink uint64
+	Uid   uint32
+	Gid   uint32
+	Atime time.Time
+	Ctime time.Time
+}
+
+func getSysStat(info fs.FileInfo) (sysStat, bool) {
+	return sysStat{}, false
+}
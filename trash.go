@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/cockroachdb/errors"
+	"github.com/laurent22/go-trash"
+	"go.uber.org/zap"
+)
+
+// errNoTrash is returned by moveToTrash when there is no trash to move to,
+// or no trash directory can be written.
+var errNoTrash = errors.New("no trash available")
+
+// deletePermanently is set by --delete-permanently, paths that cannot be
+// moved to a trash are then deleted instead of failing.
+var deletePermanently bool
+
+// moveToTrash moves path to the trash and returns its location there. The
+// location is empty when the platform trash does not report it.
+func moveToTrash(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		if !trash.IsAvailable() {
+			return "", errNoTrash
+		}
+		_, err = trash.MoveToTrash(path)
+		return "", err
+	default:
+		return freedesktopTrash(path)
+	}
+}
+
+// trashOrDelete moves path to the trash, or deletes it if there is none and
+// --delete-permanently is given, and records what happened in journal.
+func trashOrDelete(path string, journal *journal) error {
+	rec, err := journal.Describe(opTrash, path, "", path)
+	if err != nil {
+		return errors.Wrap(err, "journal")
+	}
+
+	rec.Trash, err = moveToTrash(path)
+	if errors.Is(err, errNoTrash) {
+		if !deletePermanently {
+			return errors.Wrapf(err, "path: %s, pass --delete-permanently to delete it anyway", path)
+		}
+		zap.L().Warn("No trash, deleting", zap.String("path", path), zap.Error(err))
+		rec.Op = opDelete
+		err = os.RemoveAll(path)
+	}
+	if err != nil {
+		return err
+	}
+	return journal.Append(rec)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli/v3"
+)
+
+var cmdTrash = &cli.Command{
+	Name:  "trash",
+	Usage: "List, restore and remove what gofd and other programs moved to the trash",
+	Commands: []*cli.Command{
+		cmdTrashList,
+		cmdTrashRestore,
+		cmdTrashEmpty,
+		cmdTrashPurge,
+	},
+}
+
+func olderThanFlag() cli.Flag {
+	return &cli.StringFlag{
+		Name:  "older-than",
+		Usage: "only entries trashed longer ago than a duration, e.g. 30d",
+	}
+}
+
+func trashPathsArg() cli.Argument {
+	return &cli.StringArgs{Name: "path", Config: trimSpaceConfig, Max: -1}
+}
+
+// selectTrash returns the entries of every trash that were trashed from
+// one of paths or from inside them, all entries if paths is empty, and
+// that were trashed longer ago than --older-than.
+func selectTrash(command *cli.Command, now time.Time) ([]trashEntry, error) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return nil, errors.Newf("trash management is not supported on %s, use the system trash", runtime.GOOS)
+	}
+
+	var cutoff time.Time
+	if s := command.String("older-than"); s != "" {
+		d, err := parseDuration(s)
+		if err != nil {
+			return nil, err
+		}
+		cutoff = now.Add(-d)
+	}
+	paths := command.StringArgs("path")
+	for i, p := range paths {
+		var err error
+		paths[i], err = filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := listTrash()
+	if err != nil {
+		return nil, err
+	}
+	var result []trashEntry
+	for _, e := range entries {
+		if !cutoff.IsZero() && !e.Deleted.Before(cutoff) {
+			continue
+		}
+		if len(paths) > 0 && !trashedFrom(e, paths) {
+			continue
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+func trashedFrom(e trashEntry, paths []string) bool {
+	for _, p := range paths {
+		if e.Path == p || isInside(p, e.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+var cmdTrashList = &cli.Command{
+	Name:      "list",
+	Usage:     "List the trashed entries, newest first, optionally only those trashed from PATHs",
+	Arguments: []cli.Argument{trashPathsArg()},
+	Flags:     []cli.Flag{olderThanFlag()},
+	Action: func(ctx context.Context, command *cli.Command) error {
+		entries, err := selectTrash(command, time.Now())
+		if err != nil {
+			return err
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header("Deleted", "Size", "Path", "Trashed as")
+		for _, e := range entries {
+			size := "-"
+			if info, err := os.Lstat(e.File()); err == nil && !info.IsDir() {
+				size = humanSize(info.Size())
+			}
+			err = table.Append(e.Deleted.Format(time.DateTime), size, e.Path, e.File())
+			if err != nil {
+				return err
+			}
+		}
+		return table.Render()
+	},
+}
+
+var cmdTrashRestore = &cli.Command{
+	Name:      "restore",
+	Usage:     "Move entries trashed from PATHs, or from inside them, back to where they were",
+	Arguments: []cli.Argument{trashPathsArg()},
+	Flags:     []cli.Flag{olderThanFlag()},
+	Action: func(ctx context.Context, command *cli.Command) error {
+		if len(command.StringArgs("path")) == 0 {
+			return errors.New("path is required")
+		}
+		entries, err := selectTrash(command, time.Now())
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return errors.New("nothing in the trash was trashed from there")
+		}
+
+		// entries are newest first, a path trashed several times gets its
+		// latest version back
+		failed := 0
+		restored := map[string]bool{}
+		for _, e := range entries {
+			if restored[e.Path] {
+				continue
+			}
+			err = e.Restore()
+			if err != nil {
+				failed++
+				fmt.Printf("Cannot restore %s: %v\n", e.Path, err)
+				continue
+			}
+			restored[e.Path] = true
+			fmt.Printf("Restored %s from %s\n", e.Path, e.File())
+		}
+		if failed > 0 {
+			return errors.Newf("%d entries cannot be restored", failed)
+		}
+		return nil
+	},
+}
+
+// removeTrash deletes entries permanently, or only prints them in a dry run.
+func removeTrash(entries []trashEntry, dryRun bool) error {
+	for _, e := range entries {
+		if dryRun {
+			fmt.Printf("[Dry run] Remove %s, trashed from %s\n", e.File(), e.Path)
+			continue
+		}
+		err := e.Remove()
+		if err != nil {
+			return errors.Wrapf(err, "remove %s", e.File())
+		}
+		fmt.Printf("Removed %s, trashed from %s\n", e.File(), e.Path)
+	}
+	return nil
+}
+
+var cmdTrashEmpty = &cli.Command{
+	Name:  "empty",
+	Usage: "Permanently delete every trashed entry, or those older than --older-than",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{Name: "execute", Aliases: []string{"x"}},
+		olderThanFlag(),
+	},
+	Action: func(ctx context.Context, command *cli.Command) error {
+		entries, err := selectTrash(command, time.Now())
+		if err != nil {
+			return err
+		}
+		return removeTrash(entries, !command.Bool("execute"))
+	},
+}
+
+var cmdTrashPurge = &cli.Command{
+	Name:      "purge",
+	Usage:     "Permanently delete the entries trashed from PATHs or from inside them",
+	Arguments: []cli.Argument{trashPathsArg()},
+	Flags: []cli.Flag{
+		&cli.BoolFlag{Name: "execute", Aliases: []string{"x"}},
+		olderThanFlag(),
+	},
+	Action: func(ctx context.Context, command *cli.Command) error {
+		if len(command.StringArgs("path")) == 0 {
+			return errors.New("path is required, use gofd trash empty for everything")
+		}
+		entries, err := selectTrash(command, time.Now())
+		if err != nil {
+			return err
+		}
+		return removeTrash(entries, !command.Bool("execute"))
+	},
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/spf13/afero"
+	"go.uber.org/zap"
+)
+
+// homeTrashDir returns the trash directory of the user, following the
+// FreeDesktop.org trash specification.
+func homeTrashDir() (string, error) {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dataHome, "Trash"), nil
+}
+
+// trashDirFor returns the trash directory for path and the directory the
+// paths recorded in it are relative to, empty for the home trash, which
+// records absolute paths. Paths on other file systems than the home trash
+// go to the trash at the top of their own file system, so trashing does not
+// copy data, or to the home trash when that one cannot be created.
+func trashDirFor(path string) (dir string, topDir string, err error) {
+	home, err := homeTrashDir()
+	if err != nil {
+		return "", "", err
+	}
+	err = os.MkdirAll(home, 0700)
+	if err != nil {
+		return "", "", err
+	}
+
+	homeDev, ok, err := deviceOf(home)
+	if err != nil {
+		return "", "", err
+	}
+	pathDev, _, err := deviceOf(path)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok || homeDev == pathDev {
+		return home, "", nil
+	}
+
+	topDir, _, err = mountPointOf(path)
+	if err != nil {
+		return "", "", err
+	}
+	uid := strconv.Itoa(os.Getuid())
+
+	// an administrator created $topdir/.Trash, it must be sticky and not a link
+	shared := filepath.Join(topDir, ".Trash")
+	if info, err := os.Lstat(shared); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+		dir = filepath.Join(shared, uid)
+		if err = os.MkdirAll(dir, 0700); err == nil {
+			return dir, topDir, nil
+		}
+	}
+	dir = filepath.Join(topDir, ".Trash-"+uid)
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		zap.L().Warn("Cannot create trash, using the home trash",
+			zap.String("path", dir), zap.Error(err))
+		return home, "", nil
+	}
+	return dir, topDir, nil
+}
+
+// trashDateLayout is the local time format of DeletionDate.
+const trashDateLayout = "2006-01-02T15:04:05"
+
+// trashInfoPath returns the .trashinfo file of an entry in a trash.
+func trashInfoPath(trashed string) string {
+	trashDir := filepath.Dir(filepath.Dir(trashed))
+	return filepath.Join(trashDir, "info", filepath.Base(trashed)+".trashinfo")
+}
+
+// freedesktopTrash moves path into the trash of its file system and writes
+// the .trashinfo file other trash implementations use to restore it. It
+// returns errNoTrash if the home trash cannot be written.
+func freedesktopTrash(path string) (string, error) {
+	dir, topDir, err := trashDirFor(path)
+	if err != nil {
+		return "", errors.Mark(errors.Wrap(err, "find trash directory"), errNoTrash)
+	}
+	filesDir := filepath.Join(dir, "files")
+	infoDir := filepath.Join(dir, "info")
+	for _, d := range []string{filesDir, infoDir} {
+		err = os.MkdirAll(d, 0700)
+		if err != nil {
+			return "", errors.Mark(err, errNoTrash)
+		}
+	}
+
+	recorded := path
+	if topDir != "" {
+		recorded, err = filepath.Rel(topDir, path)
+		if err != nil {
+			return "", err
+		}
+	}
+	info := fmt.Sprintf("[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+		(&url.URL{Path: recorded}).EscapedPath(), time.Now().Format(trashDateLayout))
+
+	// creating the info file exclusively reserves the name in the trash
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s.%d%s", stem, i, ext)
+		}
+		infoPath := filepath.Join(infoDir, name+".trashinfo")
+		f, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			if errors.Is(err, os.ErrExist) {
+				continue
+			}
+			return "", errors.Mark(err, errNoTrash)
+		}
+		_, err = f.WriteString(info)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		trashed := filepath.Join(filesDir, name)
+		if _, statErr := os.Lstat(trashed); err == nil && statErr == nil {
+			// a leftover without info file, never overwrite it
+			_ = os.Remove(infoPath)
+			continue
+		}
+		if err == nil {
+			err = os.Rename(path, trashed)
+			if IsCrossDeviceLinkErrno(err) {
+				// the home trash of a path whose own trash cannot be written
+				err = moveAcrossDevices(path, trashed, reflinkAuto)
+			}
+		}
+		if err != nil {
+			_ = os.Remove(infoPath)
+			return "", err
+		}
+		return trashed, nil
+	}
+}
+
+// trashEntry is an entry of a trash directory.
+type trashEntry struct {
+	// Dir is the trash directory, Name the name of the entry in its files
+	// and info directories
+	Dir  string
+	Name string
+	// Path is where the entry was trashed from
+	Path    string
+	Deleted time.Time
+
+	// changed orders entries trashed within the same second
+	changed time.Time
+}
+
+// File returns where the trashed entry is.
+func (e trashEntry) File() string {
+	return filepath.Join(e.Dir, "files", e.Name)
+}
+
+// Info returns the .trashinfo file of the entry.
+func (e trashEntry) Info() string {
+	return filepath.Join(e.Dir, "info", e.Name+".trashinfo")
+}
+
+// Remove deletes the entry permanently, the info file goes last so an
+// interrupted removal leaves nothing unaccounted for.
+func (e trashEntry) Remove() error {
+	err := os.RemoveAll(e.File())
+	if err != nil {
+		return err
+	}
+	return os.Remove(e.Info())
+}
+
+// Restore moves the entry back to its original path, which must be free.
+func (e trashEntry) Restore() error {
+	return restoreFromTrash(e.File(), e.Path)
+}
+
+// restoreFromTrash moves trashed back to path and removes its info file.
+func restoreFromTrash(trashed string, path string) error {
+	_, err := os.Lstat(path)
+	if err == nil {
+		return errors.Wrapf(ErrFileExists, "path: %s", path)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	dir := filepath.Dir(path)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	err = MoveAction{fs: afero.NewOsFs(), dst: dir, name: filepath.Base(path)}.Execute(trashed)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(trashInfoPath(trashed))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// parseTrashInfo reads the original path and deletion date of a .trashinfo
+// file. Relative paths are relative to topDir, the top of the file system
+// of a per-mount trash.
+func parseTrashInfo(r io.Reader, topDir string) (path string, deleted time.Time, err error) {
+	scanner := bufio.NewScanner(r)
+	section := ""
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			section = line
+			continue
+		}
+		if section != "[Trash Info]" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Path":
+			path, err = url.PathUnescape(value)
+			if err != nil {
+				return "", time.Time{}, errors.Wrapf(err, "invalid path: %s", value)
+			}
+		case "DeletionDate":
+			deleted, err = time.ParseInLocation(trashDateLayout, value, time.Local)
+			if err != nil {
+				return "", time.Time{}, errors.Wrapf(err, "invalid deletion date: %s", value)
+			}
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", time.Time{}, err
+	}
+	if path == "" {
+		return "", time.Time{}, errors.New("no path")
+	}
+	if !filepath.IsAbs(path) {
+		if topDir == "" {
+			return "", time.Time{}, errors.Newf("relative path in the home trash: %s", path)
+		}
+		path = filepath.Join(topDir, path)
+	}
+	return filepath.Clean(path), deleted, nil
+}
+
+// trashLocation is a trash directory and the directory the paths recorded
+// in it are relative to, empty for the home trash.
+type trashLocation struct {
+	dir    string
+	topDir string
+}
+
+// trashDirs returns the existing trash directories of the user, the home
+// trash first.
+func trashDirs() ([]trashLocation, error) {
+	home, err := homeTrashDir()
+	if err != nil {
+		return nil, err
+	}
+	dirs := []trashLocation{{dir: home}}
+	seen := map[string]bool{home: true}
+
+	mounts, err := mountPoints()
+	if err != nil {
+		return nil, err
+	}
+	uid := strconv.Itoa(os.Getuid())
+	for _, topDir := range mounts {
+		candidates := []string{filepath.Join(topDir, ".Trash-"+uid)}
+		shared := filepath.Join(topDir, ".Trash")
+		if info, err := os.Lstat(shared); err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0 {
+			candidates = append(candidates, filepath.Join(shared, uid))
+		}
+		for _, dir := range candidates {
+			if info, err := os.Lstat(dir); err == nil && info.IsDir() && !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, trashLocation{dir: dir, topDir: topDir})
+			}
+		}
+	}
+	return dirs, nil
+}
+
+// readTrash returns the entries of a trash directory. Unreadable info
+// files are skipped with a warning, and so are entries whose file is gone.
+func readTrash(dir string, topDir string) ([]trashEntry, error) {
+	infos, err := os.ReadDir(filepath.Join(dir, "info"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var entries []trashEntry
+	for _, info := range infos {
+		name, ok := strings.CutSuffix(info.Name(), ".trashinfo")
+		if !ok || info.IsDir() {
+			continue
+		}
+		e := trashEntry{Dir: dir, Name: name}
+		f, err := os.Open(e.Info())
+		if err != nil {
+			zap.L().Warn("Cannot read trash info", zap.String("path", e.Info()), zap.Error(err))
+			continue
+		}
+		e.Path, e.Deleted, err = parseTrashInfo(f, topDir)
+		_ = f.Close()
+		if err != nil {
+			zap.L().Warn("Invalid trash info", zap.String("path", e.Info()), zap.Error(err))
+			continue
+		}
+		if _, err = os.Lstat(e.File()); err != nil {
+			continue
+		}
+		if fi, err := info.Info(); err == nil {
+			e.changed = fi.ModTime()
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// listTrash returns the entries of every trash of the user, newest first.
+func listTrash() ([]trashEntry, error) {
+	dirs, err := trashDirs()
+	if err != nil {
+		return nil, err
+	}
+	var entries []trashEntry
+	for _, d := range dirs {
+		e, err := readTrash(d.dir, d.topDir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "trash: %s", d.dir)
+		}
+		entries = append(entries, e...)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].Deleted.Equal(entries[j].Deleted) {
+			return entries[i].Deleted.After(entries[j].Deleted)
+		}
+		return entries[i].changed.After(entries[j].changed)
+	})
+	return entries, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/suite"
+)
+
+type TrashTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func TestTrash(t *testing.T) {
+	suite.Run(t, new(TrashTestSuite))
+}
+
+func (s *TrashTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.T().Setenv("XDG_DATA_HOME", filepath.Join(s.dir, "data"))
+}
+
+func (s *TrashTestSuite) write(name string, content string) string {
+	path := filepath.Join(s.dir, name)
+	s.Require().NoError(os.MkdirAll(filepath.Dir(path), 0755))
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func (s *TrashTestSuite) TestParseTrashInfo() {
+	path, deleted, err := parseTrashInfo(strings.NewReader(
+		"[Trash Info]\nPath=/home/user/a%20b.txt\nDeletionDate=2024-05-06T07:08:09\n"), "")
+	s.NoError(err)
+	s.Equal("/home/user/a b.txt", path)
+	s.Equal(time.Date(2024, 5, 6, 7, 8, 9, 0, time.Local), deleted)
+
+	path, _, err = parseTrashInfo(strings.NewReader(
+		"[Trash Info]\nPath=photos/a.jpg\nDeletionDate=2024-05-06T07:08:09\n"), "/media/disk")
+	s.NoError(err)
+	s.Equal("/media/disk/photos/a.jpg", path)
+
+	_, _, err = parseTrashInfo(strings.NewReader("[Trash Info]\nPath=a.jpg\n"), "")
+	s.ErrorContains(err, "relative path")
+	_, _, err = parseTrashInfo(strings.NewReader("[Other]\nPath=/a.jpg\n"), "")
+	s.ErrorContains(err, "no path")
+	_, _, err = parseTrashInfo(strings.NewReader("[Trash Info]\nPath=/a.jpg\nDeletionDate=yesterday\n"), "")
+	s.ErrorContains(err, "invalid deletion date")
+}
+
+func (s *TrashTestSuite) TestReadTrash() {
+	a := s.write("d/a.txt", "a")
+	trashed, err := freedesktopTrash(a)
+	s.Require().NoError(err)
+	s.write("d/a.txt", "b")
+	_, err = freedesktopTrash(a)
+	s.Require().NoError(err)
+
+	// an info file without its entry is skipped
+	home, err := homeTrashDir()
+	s.Require().NoError(err)
+	s.Require().NoError(os.WriteFile(filepath.Join(home, "info", "gone.trashinfo"),
+		[]byte("[Trash Info]\nPath=/gone\nDeletionDate=2024-05-06T07:08:09\n"), 0600))
+
+	entries, err := readTrash(home, "")
+	s.Require().NoError(err)
+	s.Require().Len(entries, 2)
+	for _, e := range entries {
+		s.Equal(a, e.Path)
+		s.WithinDuration(time.Now(), e.Deleted, time.Minute)
+	}
+
+	e := trashEntry{Dir: home, Name: filepath.Base(trashed), Path: a}
+	s.Equal(trashed, e.File())
+	s.NoError(e.Restore())
+	s.FileExists(a)
+	s.NoFileExists(e.Info())
+
+	entries, err = readTrash(home, "")
+	s.Require().NoError(err)
+	s.Require().Len(entries, 1)
+	s.ErrorIs(entries[0].Restore(), ErrFileExists)
+	s.NoError(entries[0].Remove())
+	s.NoFileExists(entries[0].File())
+	s.NoFileExists(entries[0].Info())
+}
+
+func (s *TrashTestSuite) TestNoWritableTrash() {
+	// the trash cannot be created below a file
+	s.T().Setenv("XDG_DATA_HOME", filepath.Join(s.write("data", ""), "share"))
+	path := s.write("a.txt", "a")
+	j, err := openJournal(filepath.Join(s.dir, "ops.jsonl"))
+	s.Require().NoError(err)
+	defer func() { _ = j.Close() }()
+
+	err = trashOrDelete(path, j)
+	s.Require().True(errors.Is(err, errNoTrash), "%v", err)
+	s.FileExists(path)
+
+	deletePermanently = true
+	defer func() { deletePermanently = false }()
+	s.Require().NoError(trashOrDelete(path, j))
+	s.NoFileExists(path)
+	s.Require().NoError(j.Close())
+	f, err := os.Open(filepath.Join(s.dir, "ops.jsonl"))
+	s.Require().NoError(err)
+	defer func() { _ = f.Close() }()
+	records, err := readJournal(f)
+	s.Require().NoError(err)
+	s.Require().Len(records, 1)
+	s.Equal(opDelete, records[0].Op)
+}
+
+func (s *TrashTestSuite) TestHomeTrashFallback() {
+	// /dev/shm is a file system of its own whose trash cannot be created
+	// below a file of the same name
+	const mount = "/dev/shm"
+	homeDev, _, err := deviceOf(s.dir)
+	s.Require().NoError(err)
+	shmDev, ok, err := deviceOf(mount)
+	if err != nil || !ok || shmDev == homeDev {
+		s.T().Skip("no second file system at " + mount)
+	}
+	topTrash := filepath.Join(mount, ".Trash-"+strconv.Itoa(os.Getuid()))
+	if _, err := os.Lstat(topTrash); err == nil {
+		s.T().Skip(topTrash + " exists")
+	}
+	s.Require().NoError(os.WriteFile(topTrash, nil, 0600))
+	defer func() { _ = os.Remove(topTrash) }()
+
+	dir, err := os.MkdirTemp(mount, "gofd-trash-")
+	s.Require().NoError(err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	path := filepath.Join(dir, "a.txt")
+	s.Require().NoError(os.WriteFile(path, []byte("a"), 0600))
+
+	trashed, err := moveToTrash(path)
+	s.Require().NoError(err)
+	s.NoFileExists(path)
+	s.Equal(filepath.Join(s.dir, "data", "Trash", "files", "a.txt"), trashed)
+	content, err := os.ReadFile(trashed)
+	s.Require().NoError(err)
+	s.Equal("a", string(content))
+
+	info, err := os.Open(trashInfoPath(trashed))
+	s.Require().NoError(err)
+	defer func() { _ = info.Close() }()
+	recorded, _, err := parseTrashInfo(info, "")
+	s.Require().NoError(err)
+	s.Equal(path, recorded)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/errors"
+	"github.com/spf13/afero"
+	"github.com/urfave/cli/v3"
+)
+
+var cmdUndo = &cli.Command{
+	Name:  "undo",
+	Usage: "Reverse the operations recorded in a journal, newest first",
+	Arguments: []cli.Argument{
+		&cli.StringArg{Name: "journal", Config: trimSpaceConfig},
+	},
+	Flags: []cli.Flag{
+		&cli.BoolFlag{Name: "execute", Aliases: []string{"x"}},
+	},
+	Action: func(ctx context.Context, command *cli.Command) error {
+		path := command.StringArg("journal")
+		if path == "" {
+			return errors.New("journal is required")
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		records, err := readJournal(f)
+		if err != nil {
+			return errors.Wrapf(err, "journal: %s", path)
+		}
+
+		dryRun := !command.Bool("execute")
+		failed := 0
+		for i := len(records) - 1; i >= 0; i-- {
+			rec := records[i]
+			from, err := undoRecord(rec, dryRun)
+			switch {
+			case err != nil:
+				failed++
+				fmt.Printf("Cannot undo %s of %s: %v\n", rec.Op, rec.Src, err)
+			case dryRun:
+				fmt.Printf("[Dry run] Restore %s from %s\n", rec.Src, from)
+			default:
+				fmt.Printf("Restored %s from %s\n", rec.Src, from)
+			}
+		}
+		if failed > 0 {
+			return errors.Newf("%d of %d operations cannot be undone", failed, len(records))
+		}
+		return nil
+	},
+}
+
+// undoRecord reverses an operation and returns where the entry was restored
+// from. Nothing is changed if the entry was modified since, or if something
+// took its original place.
+func undoRecord(rec journalRecord, dryRun bool) (string, error) {
+	var from string
+	switch rec.Op {
+	case opMove, opRemoveDuplicate:
+		from = rec.Dst
+	case opTrash:
+		if rec.Trash == "" {
+			return "", errors.New("the platform trash did not report where it went, restore it from the trash")
+		}
+		from = rec.Trash
+	case opDelete:
+		return "", errors.New("it was deleted permanently")
+	default:
+		return "", errors.Newf("unknown operation: %s", rec.Op)
+	}
+
+	_, err := os.Lstat(rec.Src)
+	if err == nil {
+		return "", errors.Newf("%s exists again", rec.Src)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	err = verifyRecord(rec, from)
+	if err != nil {
+		return "", err
+	}
+	if dryRun {
+		return from, nil
+	}
+
+	if rec.Op == opTrash {
+		return from, restoreFromTrash(from, rec.Src)
+	}
+	dir := filepath.Dir(rec.Src)
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Base(rec.Src)
+	if rec.Op == opRemoveDuplicate {
+		// the duplicate stays where it is, restore a copy of it
+		return from, CopyAction{dst: dir, name: name}.Execute(from)
+	}
+	return from, MoveAction{fs: afero.NewOsFs(), dst: dir, name: name}.Execute(from)
+}
+
+// verifyRecord checks that the entry at path is still the one rec describes.
+func verifyRecord(rec journalRecord, path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return errors.Newf("it is no longer at %s", path)
+		}
+		return err
+	}
+	if info.IsDir() != rec.IsDir || (!rec.IsDir && info.Size() != rec.Size) {
+		return errors.Newf("%s changed since", path)
+	}
+	if rec.XXHash == "" {
+		return nil
+	}
+	h, err := xxHashFile(path)
+	if err != nil {
+		return err
+	}
+	if fmt.Sprintf("0x%x", h) != rec.XXHash {
+		return errors.Newf("%s changed since", path)
+	}
+	return nil
+}
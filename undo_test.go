@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/suite"
+)
+
+type UndoTestSuite struct {
+	suite.Suite
+	dir     string
+	journal *journal
+	path    string
+}
+
+func TestUndo(t *testing.T) {
+	suite.Run(t, new(UndoTestSuite))
+}
+
+func (s *UndoTestSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+	s.T().Setenv("XDG_DATA_HOME", filepath.Join(s.dir, "data"))
+	s.path = filepath.Join(s.dir, "journal.jsonl")
+	var err error
+	s.journal, err = openJournal(s.path)
+	s.Require().NoError(err)
+}
+
+func (s *UndoTestSuite) TearDownTest() {
+	s.NoError(s.journal.Close())
+}
+
+func (s *UndoTestSuite) write(name string, content string) string {
+	path := filepath.Join(s.dir, name)
+	s.Require().NoError(os.MkdirAll(filepath.Dir(path), 0755))
+	s.Require().NoError(os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func (s *UndoTestSuite) records() []journalRecord {
+	b, err := os.ReadFile(s.path)
+	s.Require().NoError(err)
+	records, err := readJournal(bytes.NewReader(b))
+	s.Require().NoError(err)
+	return records
+}
+
+func (s *UndoTestSuite) TestUndoMove() {
+	src := s.write("src/a.txt", "a")
+	dst := filepath.Join(s.dir, "dst")
+	s.Require().NoError(os.Mkdir(dst, 0755))
+	s.Require().NoError(MoveAction{fs: afero.NewOsFs(), dst: dst, journal: s.journal}.Execute(src))
+
+	records := s.records()
+	s.Require().Len(records, 1)
+	s.Equal(opMove, records[0].Op)
+	s.Equal(src, records[0].Src)
+	s.Equal(filepath.Join(dst, "a.txt"), records[0].Dst)
+	s.Equal(int64(1), records[0].Size)
+
+	from, err := undoRecord(records[0], true)
+	s.NoError(err)
+	s.Equal(records[0].Dst, from)
+	s.NoFileExists(src)
+
+	_, err = undoRecord(records[0], false)
+	s.NoError(err)
+	s.FileExists(src)
+	s.NoFileExists(records[0].Dst)
+
+	_, err = undoRecord(records[0], false)
+	s.ErrorContains(err, "exists again")
+}
+
+func (s *UndoTestSuite) TestUndoTrash() {
+	src := s.write("a.txt", "a")
+	s.Require().NoError(DeleteAction{journal: s.journal}.Execute(src))
+	s.NoFileExists(src)
+
+	records := s.records()
+	s.Require().Len(records, 1)
+	s.Equal(opTrash, records[0].Op)
+	s.Equal(filepath.Join(s.dir, "data", "Trash", "files", "a.txt"), records[0].Trash)
+	s.FileExists(trashInfoPath(records[0].Trash))
+
+	_, err := undoRecord(records[0], false)
+	s.NoError(err)
+	s.FileExists(src)
+	s.NoFileExists(trashInfoPath(records[0].Trash))
+}
+
+func (s *UndoTestSuite) TestChangedSince() {
+	src := s.write("src/a.txt", "a")
+	dst := filepath.Join(s.dir, "dst")
+	s.Require().NoError(os.Mkdir(dst, 0755))
+	s.Require().NoError(MoveAction{fs: afero.NewOsFs(), dst: dst, journal: s.journal}.Execute(src))
+	s.write("dst/a.txt", "b")
+
+	_, err := undoRecord(s.records()[0], false)
+	s.ErrorContains(err, "changed since")
+	s.NoFileExists(src)
+
+	_, err = undoRecord(journalRecord{Op: opDelete, Src: src}, false)
+	s.ErrorContains(err, "deleted permanently")
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/olekukonko/tablewriter"
+	"github.com/urfave/cli/v3"
+)
+
+// volumeLabelFile identifies a volume without a file system UUID. gofd
+// writes it to the mount point when such a volume is indexed with
+// --label-volume.
+const volumeLabelFile = ".gofd-volume"
+
+// errVolumeUnidentified is returned for volumes without a file system UUID
+// or a label file, when writing a label file was not asked for.
+var errVolumeUnidentified = errors.New("volume has no UUID, index it with --label-volume to write a " +
+	volumeLabelFile + " file to its mount point")
+
+// volumeInfo identifies a volume, removable disks keep their UUID wherever
+// they are mounted.
+type volumeInfo struct {
+	UUID  string `json:"uuid"`
+	Label string `json:"label,omitempty"`
+
+	// MountPoint is where the volume is mounted now
+	MountPoint string `json:"-"`
+}
+
+// mountPointOf returns the mount point of the file system containing path
+// and its device ID, found by walking up until the device changes.
+func mountPointOf(path string) (string, uint64, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", 0, err
+	}
+	dev, ok, err := deviceOf(path)
+	if err != nil {
+		return "", 0, err
+	}
+	if !ok {
+		return "", 0, errors.New("device IDs are not supported on this platform")
+	}
+	for {
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path, dev, nil
+		}
+		parentDev, _, err := deviceOf(parent)
+		if err != nil {
+			return "", 0, err
+		}
+		if parentDev != dev {
+			return path, dev, nil
+		}
+		path = parent
+	}
+}
+
+// readVolumeLabel reads the label file in dir, ok is false if there is none.
+func readVolumeLabel(dir string) (v volumeInfo, ok bool, err error) {
+	b, err := os.ReadFile(filepath.Join(dir, volumeLabelFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return v, false, nil
+		}
+		return v, false, err
+	}
+	err = json.Unmarshal(b, &v)
+	if err != nil || v.UUID == "" {
+		return v, false, errors.Newf("invalid volume label file in %s", dir)
+	}
+	return v, true, nil
+}
+
+func writeVolumeLabel(dir string, v volumeInfo) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, volumeLabelFile), append(b, '\n'), 0644)
+}
+
+// newVolumeUUID returns a random version 4 UUID.
+func newVolumeUUID() (string, error) {
+	var b [16]byte
+	_, err := rand.Read(b[:])
+	if err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+// identifyVolume returns the volume path is on. A label file at the mount
+// point wins over the file system UUID, without either a label file is
+// written if write is set. label overrides the name of the volume if set.
+func identifyVolume(path string, label string, write bool) (volumeInfo, error) {
+	mountPoint, dev, err := mountPointOf(path)
+	if err != nil {
+		return volumeInfo{}, err
+	}
+
+	v, ok, err := readVolumeLabel(mountPoint)
+	if err != nil {
+		return volumeInfo{}, err
+	}
+	if !ok {
+		v.UUID, v.Label = diskIdentity(dev)
+	}
+	if v.UUID == "" && !write {
+		return volumeInfo{}, errors.Wrapf(errVolumeUnidentified, "mount point: %s", mountPoint)
+	}
+	if v.UUID == "" {
+		v.UUID, err = newVolumeUUID()
+		if err != nil {
+			return volumeInfo{}, err
+		}
+		v.Label = label
+		err = writeVolumeLabel(mountPoint, v)
+		if err != nil {
+			return volumeInfo{}, errors.Wrap(err, "volume has no UUID, write label file")
+		}
+	}
+
+	if label != "" {
+		v.Label = label
+	}
+	if v.Label == "" {
+		v.Label = filepath.Base(mountPoint)
+	}
+	v.MountPoint = mountPoint
+	return v, nil
+}
+
+// mountedVolumes maps the UUID of every mounted volume to its mount point.
+func mountedVolumes() (map[string]string, error) {
+	mounts, err := mountPoints()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	for _, mountPoint := range mounts {
+		uuid := ""
+		if v, ok, _ := readVolumeLabel(mountPoint); ok {
+			uuid = v.UUID
+		} else if dev, ok, err := deviceOf(mountPoint); err == nil && ok {
+			uuid, _ = diskIdentity(dev)
+		}
+		if _, seen := result[uuid]; uuid != "" && !seen {
+			result[uuid] = mountPoint
+		}
+	}
+	return result, nil
+}
+
+// catalogFile is a match of a volume search.
+type catalogFile struct {
+	UUID       string
+	Label      string
+	Root       string
+	VolumePath string
+	Path       string
+}
+
+// OnVolume returns the path of the file below the mount point of its volume.
+func (f *catalogFile) OnVolume() string {
+	return filepath.Join(f.VolumePath, f.Path)
+}
+
+// Matches reports whether path is where the file was indexed, or a suffix
+// of its path on the volume.
+func (f *catalogFile) Matches(path string) bool {
+	if filepath.IsAbs(path) && path == filepath.Join(f.Root, f.Path) {
+		return true
+	}
+	onVolume := f.OnVolume()
+	return onVolume == path || strings.HasSuffix(onVolume, string(filepath.Separator)+path)
+}
+
+// Locate returns the path of the file if its volume is mounted, or ok is
+// false if it has to be mounted first. Roots without a volume are assumed
+// to be where they were indexed.
+func (f *catalogFile) Locate(mounted map[string]string) (path string, ok bool) {
+	if f.UUID == "" {
+		return filepath.Join(f.Root, f.Path), true
+	}
+	mountPoint, ok := mounted[f.UUID]
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(mountPoint, f.OnVolume()), true
+}
+
+// searchCatalog returns the files of a catalog matching a condition on the
+// files table f.
+func searchCatalog(dsn string, where string, args ...any) ([]catalogFile, error) {
+	db, err := openCatalog(dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = db.Close() }()
+
+	rows, err := db.Query(`SELECT coalesce(v.uuid, ''), coalesce(v.label, ''), r.path,
+		coalesce(r.volume_path, ''), f.path
+		FROM files f JOIN roots r ON r.id = f.root_id LEFT JOIN volumes v ON v.id = r.volume_id
+		WHERE `+where+` ORDER BY v.label, r.path, f.path`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var result []catalogFile
+	for rows.Next() {
+		var f catalogFile
+		err = rows.Scan(&f.UUID, &f.Label, &f.Root, &f.VolumePath, &f.Path)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, f)
+	}
+	return result, rows.Err()
+}
+
+func catalogsFlag() cli.Flag {
+	return &cli.StringSliceFlag{
+		Name:     "dsn",
+		Usage:    "catalog databases written by gofd index, may be repeated",
+		Required: true,
+	}
+}
+
+var cmdVolume = &cli.Command{
+	Name:  "volume",
+	Usage: "List and search the volumes of catalogs, mounted or not",
+	Commands: []*cli.Command{
+		cmdVolumeList,
+		cmdVolumeSearch,
+		cmdVolumeLocate,
+	},
+}
+
+var cmdVolumeList = &cli.Command{
+	Name:  "list",
+	Flags: []cli.Flag{catalogsFlag()},
+	Action: func(ctx context.Context, command *cli.Command) error {
+		mounted, err := mountedVolumes()
+		if err != nil {
+			return err
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header("UUID", "Label", "Mounted", "Roots", "Files", "Catalog")
+		for _, dsn := range command.StringSlice("dsn") {
+			err = listVolumes(dsn, func(v volumeInfo, lastSeen time.Time, roots int, files int) error {
+				state := "offline, last at " + v.MountPoint + " " + lastSeen.Format(time.DateOnly)
+				if mountPoint, ok := mounted[v.UUID]; ok {
+					state = mountPoint
+				}
+				return table.Append(v.UUID, v.Label, state, roots, files, dsn)
+			})
+			if err != nil {
+				return errors.Wrapf(err, "catalog: %s", dsn)
+			}
+		}
+		return table.Render()
+	},
+}
+
+func listVolumes(dsn string, fn func(v volumeInfo, lastSeen time.Time, roots int, files int) error) error {
+	db, err := openCatalog(dsn)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Close() }()
+
+	rows, err := db.Query(`SELECT v.uuid, v.label, coalesce(v.mount_point, ''), coalesce(v.seen_at, 0),
+		(SELECT count(*) FROM roots r WHERE r.volume_id = v.id),
+		(SELECT count(*) FROM files f JOIN roots r ON r.id = f.root_id WHERE r.volume_id = v.id)
+		FROM volumes v ORDER BY v.label`)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var v volumeInfo
+		var seenAt int64
+		var roots, files int
+		err = rows.Scan(&v.UUID, &v.Label, &v.MountPoint, &seenAt, &roots, &files)
+		if err != nil {
+			return err
+		}
+		err = fn(v, time.Unix(0, seenAt), roots, files)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+var cmdVolumeSearch = &cli.Command{
+	Name:  "search",
+	Usage: "Search every catalog by name, or by path below the volume if the pattern has a /",
+	Arguments: []cli.Argument{
+		&cli.StringArg{Name: "pattern"},
+	},
+	Flags: []cli.Flag{catalogsFlag()},
+	Action: func(ctx context.Context, command *cli.Command) error {
+		pattern := command.StringArg("pattern")
+		if pattern == "" {
+			return errors.New("pattern is required")
+		}
+		where := "f.name GLOB ?"
+		if strings.ContainsRune(pattern, '/') {
+			where = "coalesce(nullif(r.volume_path, '') || '/', '') || f.path GLOB ?"
+		}
+
+		mounted, err := mountedVolumes()
+		if err != nil {
+			return err
+		}
+		for _, dsn := range command.StringSlice("dsn") {
+			files, err := searchCatalog(dsn, where, pattern)
+			if err != nil {
+				return errors.Wrapf(err, "catalog: %s", dsn)
+			}
+			for _, f := range files {
+				if path, ok := f.Locate(mounted); ok {
+					fmt.Println(path)
+				} else {
+					fmt.Printf("[%s] %s\n", f.Label, f.OnVolume())
+				}
+			}
+		}
+		return nil
+	},
+}
+
+var cmdVolumeLocate = &cli.Command{
+	Name:  "locate",
+	Usage: "Report which volume to mount to reach a file, given its indexed path or its path on the volume",
+	Arguments: []cli.Argument{
+		&cli.StringArg{Name: "path"},
+	},
+	Flags: []cli.Flag{catalogsFlag()},
+	Action: func(ctx context.Context, command *cli.Command) error {
+		path := command.StringArg("path")
+		if path == "" {
+			return errors.New("path is required")
+		}
+		path = filepath.Clean(path)
+
+		mounted, err := mountedVolumes()
+		if err != nil {
+			return err
+		}
+		found := false
+		for _, dsn := range command.StringSlice("dsn") {
+			files, err := searchCatalog(dsn, "f.name = ?", filepath.Base(path))
+			if err != nil {
+				return errors.Wrapf(err, "catalog: %s", dsn)
+			}
+			for _, f := range files {
+				if !f.Matches(path) {
+					continue
+				}
+				found = true
+				if p, ok := f.Locate(mounted); ok {
+					fmt.Printf("mounted: %s\n", p)
+				} else {
+					fmt.Printf("mount %s (UUID %s) to reach %s\n", f.Label, f.UUID, f.OnVolume())
+				}
+			}
+		}
+		if !found {
+			return errors.Newf("not in any catalog: %s", path)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// diskIdentity returns the file system UUID and label of the block device
+// dev from the udev links in /dev/disk, empty if there are none.
+func diskIdentity(dev uint64) (uuid string, label string) {
+	return diskLink("/dev/disk/by-uuid", dev), diskLink("/dev/disk/by-label", dev)
+}
+
+func diskLink(dir string, dev uint64) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, entry := range entries {
+		info, err := os.Stat(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if st, ok := getSysStat(info); ok && st.Rdev == dev {
+			return unescapeUdev(entry.Name())
+		}
+	}
+	return ""
+}
+
+// unescapeUdev decodes the \xNN escapes udev uses in link names.
+func unescapeUdev(name string) string {
+	if !strings.Contains(name, `\x`) {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if i+3 < len(name) && name[i] == '\\' && name[i+1] == 'x' {
+			if c, err := strconv.ParseUint(name[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// mountPoints lists the mount points of the system from mountinfo.
+func mountPoints() ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var result []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		result = append(result, unescapeMountInfo(fields[4]))
+	}
+	return result, scanner.Err()
+}
+
+// unescapeMountInfo decodes the octal escapes of spaces, tabs, newlines and
+// backslashes in mountinfo fields.
+func unescapeMountInfo(s string) string {
+	return strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`).Replace(s)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+// diskIdentity is only implemented on Linux, elsewhere volumes are always
+// identified by a label file.
+func diskIdentity(dev uint64) (uuid string, label string) {
+	return "", ""
+}
+
+// mountPoints is only implemented on Linux, elsewhere nothing is reported
+// as mounted.
+func mountPoints() ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type VolumeTestSuite struct {
+	suite.Suite
+}
+
+func TestVolume(t *testing.T) {
+	suite.Run(t, new(VolumeTestSuite))
+}
+
+func (s *VolumeTestSuite) TestLabelFile() {
+	dir := s.T().TempDir()
+	_, ok, err := readVolumeLabel(dir)
+	s.NoError(err)
+	s.False(ok)
+
+	uuid, err := newVolumeUUID()
+	s.Require().NoError(err)
+	s.Regexp(regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), uuid)
+
+	s.Require().NoError(writeVolumeLabel(dir, volumeInfo{UUID: uuid, Label: "backup", MountPoint: dir}))
+	v, ok, err := readVolumeLabel(dir)
+	s.NoError(err)
+	s.True(ok)
+	s.Equal(volumeInfo{UUID: uuid, Label: "backup"}, v)
+}
+
+func (s *VolumeTestSuite) TestLocate() {
+	f := catalogFile{UUID: "u1", Label: "backup", Root: "/media/old/photos", VolumePath: "photos", Path: "2024/a.jpg"}
+	s.Equal("photos/2024/a.jpg", f.OnVolume())
+
+	s.True(f.Matches("/media/old/photos/2024/a.jpg"))
+	s.True(f.Matches("photos/2024/a.jpg"))
+	s.True(f.Matches("2024/a.jpg"))
+	s.False(f.Matches("24/a.jpg"))
+	s.False(f.Matches("/media/new/photos/2024/a.jpg"))
+
+	_, ok := f.Locate(map[string]string{"u2": "/media/other"})
+	s.False(ok)
+	path, ok := f.Locate(map[string]string{"u1": "/media/new"})
+	s.True(ok)
+	s.Equal("/media/new/photos/2024/a.jpg", path)
+
+	f.UUID = ""
+	path, ok = f.Locate(nil)
+	s.True(ok)
+	s.Equal("/media/old/photos/2024/a.jpg", path)
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// copyXattrs is only implemented on Linux, elsewhere extended attributes are
+// not preserved.
+func copyXattrs(src string, dst string) error {
+	return nil
+}